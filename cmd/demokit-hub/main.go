@@ -0,0 +1,25 @@
+// Command demokit-hub runs a WebSocketHub, a lightweight alternative to RabbitMQ for the event network.
+// Nodes join it with a core.WebSocketEventNetwork, and browsers with a plain WebSocket sending and
+// receiving JSON events.
+package main
+
+import (
+	"flag"
+	"github.com/SINTEF-Infosec/demokit/core"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", core.DefaultWebSocketHubAddr, "address to listen on")
+	debug := flag.Bool("debug", false, "enable debug logs")
+	flag.Parse()
+
+	if *debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	hub := core.NewWebSocketHub(log.WithField("node", "hub"))
+	if err := hub.Run(*addr); err != nil {
+		log.Fatalf("hub stopped: %v", err)
+	}
+}
@@ -1,11 +1,121 @@
 package core
 
+import "sort"
+
 type ActionCondition func(event *Event) bool
 
+// ActionId identifies an action registered with OnEventDo, see RemoveAction.
+type ActionId uint64
+
+// Action is a step of a chain of actions, executed when an event is received.
+//
+// The body of the action is Do (or DoContext if set) if DoCondition is nil or true, Else otherwise, followed by
+// the Parallel actions, executed concurrently. The body is executed after DoDelay milliseconds, and repeated as
+// configured by Repeat.
+// Then is executed once the body is done, i.e. once all the Parallel actions have ended.
+// Else and the Parallel actions are chains of their own: their Then actions are part of the body.
+// An action without a body (no Do, DoContext, Else nor Parallel) ends the chain: its Then is not executed.
+//
+// If the body fails (see ContextEventHandler), once retried according to Retry, OnError is executed instead of
+// Then. The error is given to the OnError branch in its context, see ActionError. Without an OnError branch,
+// the failure stops the whole chain.
+//
+// Concurrency defines how the executions of the action are scheduled when it is triggered by several events,
+// ConcurrencyWindow being the window (in milliseconds) of ConcurrencyDebounce and ConcurrencyThrottle.
 type Action struct {
 	Name        string
 	Do          EventHandler
+	DoContext   ContextEventHandler
 	DoCondition ActionCondition
 	DoDelay     int
+	Else        *Action
+	Parallel    []*Action
+	Repeat      *Repeat
+	Retry       *RetryPolicy
 	Then        *Action
+	OnError     *Action
+
+	Concurrency       ConcurrencyMode
+	ConcurrencyWindow int
+}
+
+func (a *Action) hasBody() bool {
+	return a.Do != nil || a.DoContext != nil || a.Else != nil || len(a.Parallel) > 0
+}
+
+// Repeat repeats the body of an action Count times, or until Until returns true (checked after each iteration),
+// waiting Every milliseconds between the iterations. With neither Count nor Until, the body is repeated forever:
+// as it would block the other actions of the event, such chains use ConcurrencyParallel instead of the default mode.
+type Repeat struct {
+	Count int
+	Until ActionCondition
+	Every int
+}
+
+// RegisteredAction describes an action registered for an event, as listed in the node status.
+// Pattern is true for the actions registered with OnPatternDo.
+type RegisteredAction struct {
+	Id          ActionId        `json:"id"`
+	Priority    int             `json:"priority"`
+	Pattern     bool            `json:"pattern,omitempty"`
+	Concurrency ConcurrencyMode `json:"concurrency,omitempty"`
+	Actions     []string        `json:"actions"`
+}
+
+type registeredAction struct {
+	id       ActionId
+	priority int
+	action   *Action
+	// nil for the actions registered for an exact event name
+	matcher   *eventMatcher
+	scheduler *actionScheduler
+}
+
+func (n *Node) newRegisteredAction(id ActionId, priority int, action *Action, matcher *eventMatcher) *registeredAction {
+	scheduler := newActionScheduler(n, action)
+	if !scheduler.mode.isValid() {
+		n.Logger.Warnf("unknown concurrency mode %s for %s, using the default one", scheduler.mode, action.Name)
+		scheduler.mode = ConcurrencyDefault
+	}
+	if scheduler.mode == ConcurrencyDefault && repeatsForever(action) {
+		n.Logger.Infof("%s is repeated forever, executing it in parallel", action.Name)
+		scheduler.mode = ConcurrencyParallel
+	}
+	return &registeredAction{
+		id:        id,
+		priority:  priority,
+		action:    action,
+		matcher:   matcher,
+		scheduler: scheduler,
+	}
+}
+
+// repeatsForever returns whether an action of the chain is repeated with neither Count nor Until.
+func repeatsForever(action *Action) bool {
+	if action == nil {
+		return false
+	}
+	if action.Repeat != nil && action.Repeat.Count <= 0 && action.Repeat.Until == nil {
+		return true
+	}
+	for _, parallel := range action.Parallel {
+		if repeatsForever(parallel) {
+			return true
+		}
+	}
+	return repeatsForever(action.Else) || repeatsForever(action.Then) || repeatsForever(action.OnError)
+}
+
+// sortRegisteredActions orders the actions by decreasing priority, then the exact matches before the pattern
+// matches, then by registration order.
+func sortRegisteredActions(actions []*registeredAction) {
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].priority != actions[j].priority {
+			return actions[i].priority > actions[j].priority
+		}
+		if exactI, exactJ := actions[i].matcher == nil, actions[j].matcher == nil; exactI != exactJ {
+			return exactI
+		}
+		return actions[i].id < actions[j].id
+	})
 }
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// subscribingTestNetwork records the subscriptions of the node.
+type subscribingTestNetwork struct {
+	*InMemoryEventNetwork
+
+	mutex         sync.Mutex
+	subscriptions map[string]bool
+}
+
+func (s *subscribingTestNetwork) Subscribe(eventName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscriptions[eventName] = true
+}
+
+func (s *subscribingTestNetwork) Unsubscribe(eventName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscriptions, eventName)
+}
+
+func (s *subscribingTestNetwork) subscribed() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	names := make([]string, 0, len(s.subscriptions))
+	for name := range s.subscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRemoveActionUnsubscribes(t *testing.T) {
+	network := &subscribingTestNetwork{
+		InMemoryEventNetwork: NewInMemoryEventNetwork(NewInMemoryEventBus()),
+		subscriptions:        make(map[string]bool),
+	}
+	n := newTestNodeWithNetwork(t, "node", network)
+
+	noop := &Action{Name: "noop", Do: func(_ *Event) {}}
+	first := n.OnEventDo("A", noop)
+	second := n.OnEventDo("A", noop)
+	onB := n.OnEventDo("B", noop)
+	pattern, err := n.OnPatternDo(EventPattern{Name: "I_*"}, noop)
+	if err != nil {
+		t.Fatalf("could not register the pattern: %v", err)
+	}
+	complexPattern, err := n.OnComplexEventDo(ComplexEventPattern{
+		Kind:   AllOf,
+		Events: []string{"B", "C"},
+		Window: time.Second,
+	}, noop)
+	if err != nil {
+		t.Fatalf("could not register the complex pattern: %v", err)
+	}
+
+	// The actions are removed in order
+	tests := []struct {
+		name       string
+		id         ActionId
+		subscribed []string
+	}{
+		{"one of the actions of an event", first, []string{"*", "A", "B", "C"}},
+		{"the last action of an event", second, []string{"*", "B", "C"}},
+		{"an action of an event used by a complex pattern", onB, []string{"*", "B", "C"}},
+		{"the last pattern", pattern, []string{"B", "C"}},
+		{"the complex pattern", complexPattern, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !n.RemoveAction(tt.id) {
+				t.Fatalf("action %d not found", tt.id)
+			}
+			if subscribed := network.subscribed(); !reflect.DeepEqual(subscribed, tt.subscribed) {
+				t.Errorf("subscribed to %v, want %v", subscribed, tt.subscribed)
+			}
+		})
+	}
+
+	if n.RemoveAction(first) {
+		t.Error("the action is removed twice")
+	}
+}
+
+func TestRegisteredActionsStatus(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	n.OnEventDo("A", &Action{Name: "first", Do: func(_ *Event) {}, Then: &Action{Name: "then"}})
+	n.OnEventDoWithPriority("A", 1, &Action{Name: "second", Do: func(_ *Event) {}})
+
+	details := n.getRegisteredActions()
+	if len(details["A"]) != 2 || details["A"][0].Priority != 1 {
+		t.Fatalf("details = %+v, want both actions, by priority", details)
+	}
+	want := map[string][]string{"A": {"second", "first", "then"}}
+	if names := getActionNames(details); !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestActionChains(t *testing.T) {
+	var mutex sync.Mutex
+	var executed []string
+	record := func(name string) EventHandler {
+		return func(_ *Event) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			executed = append(executed, name)
+		}
+	}
+	step := func(name string) *Action {
+		return &Action{Name: name, Do: record(name)}
+	}
+	iterations := 0
+	never := func(_ *Event) bool { return false }
+
+	tests := []struct {
+		name     string
+		action   *Action
+		executed []string
+	}{
+		{"then", &Action{Name: "a", Do: record("a"), Then: step("b")}, []string{"a", "b"}},
+		{"condition", &Action{Name: "a", Do: record("a"), DoCondition: never, Then: step("b")}, []string{"b"}},
+		{
+			"else",
+			&Action{Name: "a", Do: record("a"), DoCondition: never, Else: step("else"), Then: step("b")},
+			[]string{"else", "b"},
+		},
+		{"no body", &Action{Name: "a", DoDelay: 1, Then: step("b")}, nil},
+		{
+			"parallel",
+			&Action{Name: "a", Parallel: []*Action{step("p"), step("p")}, Then: step("b")},
+			[]string{"p", "p", "b"},
+		},
+		{"repeat count", &Action{Name: "a", Do: record("a"), Repeat: &Repeat{Count: 3}}, []string{"a", "a", "a"}},
+		{
+			"repeat until",
+			&Action{Name: "a", Do: record("a"), Repeat: &Repeat{Until: func(_ *Event) bool {
+				iterations++
+				return iterations == 2
+			}}},
+			[]string{"a", "a"},
+		},
+	}
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executed = nil
+			n.ExecuteAction(tt.action, &Event{Name: "PING"})
+			if !reflect.DeepEqual(executed, tt.executed) {
+				t.Errorf("executed %v, want %v", executed, tt.executed)
+			}
+		})
+	}
+}
+
+func TestEndlessRepeatConcurrency(t *testing.T) {
+	forever := &Repeat{Every: 1000}
+	tests := []struct {
+		name   string
+		action *Action
+		mode   ConcurrencyMode
+	}{
+		{"no repeat", &Action{Name: "a"}, ConcurrencyDefault},
+		{"count", &Action{Name: "a", Repeat: &Repeat{Count: 2}}, ConcurrencyDefault},
+		{"until", &Action{Name: "a", Repeat: &Repeat{Until: func(_ *Event) bool { return true }}}, ConcurrencyDefault},
+		{"forever", &Action{Name: "a", Repeat: forever}, ConcurrencyParallel},
+		{"forever in then", &Action{Name: "a", Then: &Action{Name: "b", Repeat: forever}}, ConcurrencyParallel},
+		{"forever in parallel", &Action{Name: "a", Parallel: []*Action{{Name: "b", Repeat: forever}}}, ConcurrencyParallel},
+		{"forever in else", &Action{Name: "a", Else: &Action{Name: "b", Repeat: forever}}, ConcurrencyParallel},
+		{"explicit mode", &Action{Name: "a", Repeat: forever, Concurrency: ConcurrencyDrop}, ConcurrencyDrop},
+	}
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mode := n.newRegisteredAction(1, 0, tt.action, nil).scheduler.mode; mode != tt.mode {
+				t.Errorf("mode = %q, want %q", mode, tt.mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeText        = "text/plain"
+	ContentTypeOctetStream = "application/octet-stream"
+
+	binaryEnvelopeLengthSize = 4
+)
+
+// IsBinary returns true if the payload of the event is binary data, held in Data.
+func (e *Event) IsBinary() bool {
+	return e.Data != nil
+}
+
+// PayloadContentType returns the content type of the payload, defaulting to ContentTypeJSON for text payloads
+// and to ContentTypeOctetStream for binary ones.
+func (e *Event) PayloadContentType() string {
+	if e.ContentType != "" {
+		return e.ContentType
+	}
+	if e.IsBinary() {
+		return ContentTypeOctetStream
+	}
+	return ContentTypeJSON
+}
+
+// BroadcastBinary broadcasts an event with a binary payload of the given content type.
+func (n *Node) BroadcastBinary(eventName, contentType string, data []byte) error {
+	return n.SendBinaryTo("*", eventName, contentType, data)
+}
+
+// SendBinaryTo sends an event with a binary payload of the given content type to the receiver.
+func (n *Node) SendBinaryTo(receiver string, eventName, contentType string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	if contentType == "" {
+		contentType = ContentTypeOctetStream
+	}
+	return n.EmitEvent(&Event{
+		Name:        eventName,
+		Receiver:    receiver,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
+// encodeBinaryEnvelope is used by the event networks to carry binary payloads without encoding them in the JSON
+// envelope. The result is made of the length of the envelope (4 bytes, big endian), the JSON encoded envelope
+// without the data, and the raw data.
+func encodeBinaryEnvelope(event *Event) ([]byte, error) {
+	envelope, err := json.Marshal(envelopeOf(event))
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binaryEnvelopeLengthSize, binaryEnvelopeLengthSize+len(envelope)+len(event.Data))
+	binary.BigEndian.PutUint32(b, uint32(len(envelope)))
+	b = append(b, envelope...)
+	return append(b, event.Data...), nil
+}
+
+// decodeBinaryEnvelope decodes the output of encodeBinaryEnvelope.
+func decodeBinaryEnvelope(b []byte) (*Event, error) {
+	if len(b) < binaryEnvelopeLengthSize {
+		return nil, fmt.Errorf("binary envelope too short")
+	}
+	length := int(binary.BigEndian.Uint32(b))
+	if length > len(b)-binaryEnvelopeLengthSize {
+		return nil, fmt.Errorf("truncated binary envelope")
+	}
+
+	var event Event
+	if err := json.Unmarshal(b[binaryEnvelopeLengthSize:binaryEnvelopeLengthSize+length], &event); err != nil {
+		return nil, fmt.Errorf("could not unmarshal envelope: %v", err)
+	}
+	event.Data = append([]byte{}, b[binaryEnvelopeLengthSize+length:]...)
+	return &event, nil
+}
+
+// envelopeOf returns a copy of the event without its binary data.
+func envelopeOf(event *Event) *Event {
+	envelope := *event
+	envelope.Data = nil
+	return &envelope
+}
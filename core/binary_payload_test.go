@@ -0,0 +1,102 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBinaryEnvelopeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{"data", Event{Name: "IMAGE", Emitter: "a", Receiver: "*", ContentType: "image/png", Data: []byte{0x89, 'P', 0}}},
+		{"empty data", Event{Name: "IMAGE", Emitter: "a", Receiver: "*", ContentType: "image/png", Data: []byte{}}},
+		{"JSON data", Event{Name: "LEVEL", Receiver: "b", ContentType: ContentTypeJSON, Data: []byte(`{"level":3}`)}},
+		{"envelope", Event{
+			Name:          "IMAGE",
+			Emitter:       "a",
+			Receiver:      "b",
+			Id:            "42",
+			CorrelationId: "c",
+			Version:       EventVersion,
+			Headers:       map[string]string{"key": "value"},
+			Data:          []byte{1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := encodeBinaryEnvelope(&tt.event)
+			if err != nil {
+				t.Fatalf("could not encode the event: %v", err)
+			}
+			decoded, err := decodeBinaryEnvelope(b)
+			if err != nil {
+				t.Fatalf("could not decode the event: %v", err)
+			}
+			if !reflect.DeepEqual(*decoded, tt.event) {
+				t.Errorf("decoded %+v, want %+v", *decoded, tt.event)
+			}
+		})
+	}
+}
+
+func TestInvalidBinaryEnvelopes(t *testing.T) {
+	valid, err := encodeBinaryEnvelope(&Event{Name: "IMAGE", Data: []byte{1, 2}})
+	if err != nil {
+		t.Fatalf("could not encode the event: %v", err)
+	}
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"too short", valid[:binaryEnvelopeLengthSize-1]},
+		{"truncated envelope", valid[:binaryEnvelopeLengthSize+2]},
+		{"invalid envelope", append([]byte{0, 0, 0, 2}, "{]"...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if event, err := decodeBinaryEnvelope(tt.b); err == nil {
+				t.Errorf("decoded %+v", event)
+			}
+		})
+	}
+}
+
+func TestPayloadContentType(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"text", Event{Payload: "{}"}, ContentTypeJSON},
+		{"binary", Event{Data: []byte{}}, ContentTypeOctetStream},
+		{"declared", Event{Payload: "hello", ContentType: ContentTypeText}, ContentTypeText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if contentType := tt.event.PayloadContentType(); contentType != tt.want {
+				t.Errorf("content type = %s, want %s", contentType, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendBinaryTo(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	emitter := newTestNode(t, "emitter", bus)
+	receiver := newTestNode(t, "receiver", bus)
+	handled := make(chan *Event, 1)
+	receiver.OnEventDo("IMAGE", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	startTestNode(emitter)
+	startTestNode(receiver)
+
+	if err := emitter.SendBinaryTo("receiver", "IMAGE", "", nil); err != nil {
+		t.Fatalf("could not send the event: %v", err)
+	}
+	event := waitForEvent(t, handled)
+	if !event.IsBinary() || len(event.Data) != 0 || event.ContentType != ContentTypeOctetStream {
+		t.Errorf("received %+v, want an empty binary payload", event)
+	}
+}
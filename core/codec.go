@@ -0,0 +1,162 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"mime"
+	"strings"
+	"sync"
+)
+
+const ContentTypeCBOR = "application/cbor"
+
+// Codec encodes and decodes events for the event networks. Its content type is used to tell the receivers
+// how to decode the events, so that nodes using different codecs can interoperate.
+type Codec interface {
+	ContentType() string
+	Encode(event *Event) ([]byte, error)
+	Decode(data []byte) (*Event, error)
+}
+
+var (
+	// JSONCodec is the default codec, readable by all the nodes and by the browsers.
+	JSONCodec Codec = jsonCodec{}
+	// CBORCodec is a compact binary codec, carrying binary payloads without base64 encoding.
+	CBORCodec Codec = newCBORCodec()
+)
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{
+		ContentTypeJSON: JSONCodec,
+		// Content type used by the first versions of the RabbitMQEventNetwork
+		ContentTypeText: JSONCodec,
+		ContentTypeCBOR: CBORCodec,
+	}
+	codecNames = map[string]Codec{
+		"json": JSONCodec,
+		"cbor": CBORCodec,
+	}
+)
+
+// RegisterCodec makes a codec available to decode the events with its content type, and by name for CodecByName.
+func RegisterCodec(name string, codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[codec.ContentType()] = codec
+	codecNames[name] = codec
+}
+
+// CodecFor returns the codec for the given content type. An empty content type stands for JSON.
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %s: %v", contentType, err)
+	}
+
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("no codec for content type %s", contentType)
+	}
+	return codec, nil
+}
+
+// CodecByName returns the codec registered with the given name, e.g. json or cbor.
+func CodecByName(name string) (Codec, error) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecNames[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %s", name)
+	}
+	return codec, nil
+}
+
+// detectCodec guesses the codec used to encode data, for the event networks unable to carry a content type.
+// Only the built-in codecs can be detected.
+func detectCodec(data []byte) (Codec, error) {
+	for _, b := range data {
+		switch {
+		case b == ' ' || b == '\t' || b == '\r' || b == '\n':
+			continue
+		case b == '{':
+			return JSONCodec, nil
+		// CBOR map, or self-described CBOR tag
+		case b >= 0xa0 && b <= 0xbf, b == 0xd9:
+			return CBORCodec, nil
+		default:
+			return nil, fmt.Errorf("could not detect the encoding of the event")
+		}
+	}
+	return nil, fmt.Errorf("empty event")
+}
+
+// decodeEvent decodes data with the codec guessed by detectCodec.
+func decodeEvent(data []byte) (*Event, error) {
+	codec, err := detectCodec(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Encode(event *Event) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (jsonCodec) Decode(data []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+type cborCodec struct {
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+func newCBORCodec() *cborCodec {
+	// Keeping the full precision of the timestamps
+	encMode, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(fmt.Sprintf("invalid CBOR encoding options: %v", err))
+	}
+	decMode, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		panic(fmt.Sprintf("invalid CBOR decoding options: %v", err))
+	}
+	return &cborCodec{
+		encMode: encMode,
+		decMode: decMode,
+	}
+}
+
+func (c *cborCodec) ContentType() string {
+	return ContentTypeCBOR
+}
+
+func (c *cborCodec) Encode(event *Event) ([]byte, error) {
+	return c.encMode.Marshal(event)
+}
+
+func (c *cborCodec) Decode(data []byte) (*Event, error) {
+	var event Event
+	if err := c.decMode.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
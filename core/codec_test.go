@@ -0,0 +1,105 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	timestamp := time.Date(2021, 11, 16, 14, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name  string
+		event Event
+		// JSON cannot tell an empty binary payload from a text one, hence the binary envelopes of the MQTT network
+		binaryCodecOnly bool
+	}{
+		{"text", Event{Name: "PING", Emitter: "a", Receiver: "*", Payload: `{"n":1}`}, false},
+		{"envelope", Event{
+			Name:          "PONG",
+			Emitter:       "b",
+			Receiver:      "a",
+			Id:            "42",
+			Timestamp:     timestamp,
+			CorrelationId: "c",
+			CausationId:   "41",
+			Version:       EventVersion,
+			Headers:       map[string]string{"key": "value"},
+		}, false},
+		{"binary", Event{Name: "IMAGE", Receiver: "*", ContentType: "image/png", Data: []byte{0, 1, 2, 0xff}}, false},
+		{"empty binary", Event{Name: "IMAGE", Receiver: "*", ContentType: "image/png", Data: []byte{}}, true},
+	}
+	for _, codec := range []Codec{JSONCodec, CBORCodec} {
+		for _, tt := range tests {
+			if tt.binaryCodecOnly && codec == JSONCodec {
+				continue
+			}
+			t.Run(codec.ContentType()+"/"+tt.name, func(t *testing.T) {
+				data, err := codec.Encode(&tt.event)
+				if err != nil {
+					t.Fatalf("could not encode the event: %v", err)
+				}
+				if detected, err := detectCodec(data); err != nil || detected != codec {
+					t.Errorf("detected codec %v (%v), want %s", detected, err, codec.ContentType())
+				}
+				decoded, err := codec.Decode(data)
+				if err != nil {
+					t.Fatalf("could not decode the event: %v", err)
+				}
+				if !decoded.Timestamp.Equal(tt.event.Timestamp) {
+					t.Errorf("timestamp = %s, want %s", decoded.Timestamp, tt.event.Timestamp)
+				}
+				decoded.Timestamp = tt.event.Timestamp
+				if !reflect.DeepEqual(*decoded, tt.event) {
+					t.Errorf("decoded %+v, want %+v", *decoded, tt.event)
+				}
+			})
+		}
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		contentType string
+		codec       Codec
+		wantErr     bool
+	}{
+		{"", JSONCodec, false},
+		{ContentTypeJSON, JSONCodec, false},
+		{"application/json; charset=utf-8", JSONCodec, false},
+		{ContentTypeText, JSONCodec, false},
+		{ContentTypeCBOR, CBORCodec, false},
+		{"application/x-protobuf", nil, true},
+		{"invalid/", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			codec, err := CodecFor(tt.contentType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if codec != tt.codec {
+				t.Errorf("codec = %v, want %v", codec, tt.codec)
+			}
+		})
+	}
+}
+
+func TestDetectCodecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"blank", []byte(" \n")},
+		{"text", []byte("hello")},
+		{"json array", []byte("[1]")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if codec, err := detectCodec(tt.data); err == nil {
+				t.Errorf("detected %s, want an error", codec.ContentType())
+			}
+		})
+	}
+}
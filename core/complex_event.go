@@ -0,0 +1,269 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ComplexEventName is the default name of the events given to the actions registered with OnComplexEventDo.
+const ComplexEventName = "COMPLEX_EVENT"
+
+// maxComplexEventBuffer is the maximum number of events kept in a window, the oldest ones being dropped.
+const maxComplexEventBuffer = 1024
+
+type ComplexEventKind string
+
+const (
+	// AllOf matches when all the events have been received within the window, in any order.
+	AllOf ComplexEventKind = "all_of"
+	// Sequence matches when the events have been received in order within the window, other events possibly
+	// being received in between.
+	Sequence ComplexEventKind = "sequence"
+	// Count matches when Count events have been received within the window (a sliding window).
+	Count ComplexEventKind = "count"
+)
+
+// ComplexEventPattern describes a combination of events received within a time window, see OnComplexEventDo.
+// Events are the names of the events taken into account, a name given several times requiring as many events, and
+// Window the maximum duration between the first and the last matched events, measured when the events are received
+// by the node. If SameEmitter is true, the events of each emitter are matched separately, e.g. to detect 5
+// LOGIN_FAIL events in a minute from the same emitter.
+// Name is the name of the event given to the action, ComplexEventName if not set.
+type ComplexEventPattern struct {
+	Name        string
+	Kind        ComplexEventKind
+	Events      []string
+	Count       int
+	Window      time.Duration
+	SameEmitter bool
+}
+
+func (p ComplexEventPattern) String() string {
+	s := fmt.Sprintf("%s(%s)", p.Kind, strings.Join(p.Events, ", "))
+	if p.Kind == Count {
+		s += fmt.Sprintf(" >= %d", p.Count)
+	}
+	s += " within " + p.Window.String()
+	if p.SameEmitter {
+		s += " from the same emitter"
+	}
+	return s
+}
+
+func (p ComplexEventPattern) validate() error {
+	if len(p.Events) == 0 {
+		return fmt.Errorf("no events in %s pattern", p.Kind)
+	}
+	if p.Window <= 0 {
+		return fmt.Errorf("invalid window %s", p.Window)
+	}
+	switch p.Kind {
+	case AllOf, Sequence:
+	case Count:
+		if p.Count <= 0 {
+			return fmt.Errorf("invalid count %d", p.Count)
+		}
+	default:
+		return fmt.Errorf("unknown complex event kind %s", p.Kind)
+	}
+	return nil
+}
+
+type receivedEvent struct {
+	event      *Event
+	receivedAt time.Time
+}
+
+type complexEventMatcher struct {
+	registered *registeredAction
+	pattern    ComplexEventPattern
+
+	mutex sync.Mutex
+	// The events received within the window, by emitter if SameEmitter is true
+	windows map[string][]receivedEvent
+}
+
+// OnComplexEventDo registers an action to execute when the events received match the pattern, e.g. when both
+// SENSOR_A_ALERT and SENSOR_B_ALERT are received within 3 seconds. The action is given an event named after the
+// pattern, whose payload is the list of the matched events encoded in JSON, also available with
+// Event.MatchedEvents. Once matched, the events are not taken into account for the next matches.
+// The returned id can be used to unregister the action with RemoveAction.
+func (n *Node) OnComplexEventDo(pattern ComplexEventPattern, action *Action) (ActionId, error) {
+	if err := pattern.validate(); err != nil {
+		return 0, err
+	}
+	if pattern.Name == "" {
+		pattern.Name = ComplexEventName
+	}
+
+	n.actionsMutex.Lock()
+	n.lastActionId++
+	id := n.lastActionId
+	matcher := &complexEventMatcher{
+		registered: n.newRegisteredAction(id, 0, action, nil),
+		pattern:    pattern,
+		windows:    make(map[string][]receivedEvent),
+	}
+	// Copying the matchers, the dispatcher may be iterating over them
+	matchers := append([]*complexEventMatcher{}, n.complexMatchers...)
+	n.complexMatchers = append(matchers, matcher)
+	n.actionsMutex.Unlock()
+
+	if subscribingNetwork, ok := n.EventNetwork.(SubscribingEventNetwork); ok {
+		for _, eventName := range pattern.Events {
+			subscribingNetwork.Subscribe(eventName)
+		}
+	}
+	n.Logger.Infof("action configured: %s -> %s (id: %d)", pattern, action.Name, id)
+	return id, nil
+}
+
+// MatchedEvents returns the events matched by a complex event pattern, for the events given to the actions
+// registered with OnComplexEventDo.
+func (e *Event) MatchedEvents() []*Event {
+	return e.matched
+}
+
+// processComplexEvents gives the event to the complex event patterns, and triggers the actions of the ones that
+// match. It is called by the dispatcher, after the actions registered for the event are triggered.
+func (n *Node) processComplexEvents(event *Event) {
+	n.actionsMutex.RLock()
+	matchers := n.complexMatchers
+	n.actionsMutex.RUnlock()
+
+	receivedAt := event.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	for _, matcher := range matchers {
+		if !containsString(matcher.pattern.Events, event.Name) {
+			continue
+		}
+		if matched := matcher.match(event, receivedAt); matched != nil {
+			matcher.registered.scheduler.trigger(n.newComplexEvent(matcher.pattern, matched))
+		}
+	}
+}
+
+func (n *Node) newComplexEvent(pattern ComplexEventPattern, matched []*Event) *Event {
+	payload, err := json.Marshal(matched)
+	if err != nil {
+		n.Logger.Errorf("could not encode the events matching %s: %v", pattern, err)
+	}
+	event := &Event{
+		Name:        pattern.Name,
+		Receiver:    n.Info.Name,
+		Payload:     string(payload),
+		ContentType: ContentTypeJSON,
+		matched:     matched,
+	}
+	n.prepareEvent(event)
+	event.SetCause(matched[len(matched)-1])
+	return event
+}
+
+// match adds the event received at the given time to its window, and returns the matched events if the pattern
+// matches. The event is inserted in the window in reception order.
+func (m *complexEventMatcher) match(event *Event, receivedAt time.Time) []*Event {
+	key := ""
+	if m.pattern.SameEmitter {
+		key = event.Emitter
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.evictExpired(receivedAt)
+	window := m.windows[key]
+	i := len(window)
+	for i > 0 && window[i-1].receivedAt.After(receivedAt) {
+		i--
+	}
+	window = append(window, receivedEvent{})
+	copy(window[i+1:], window[i:])
+	window[i] = receivedEvent{event: event, receivedAt: receivedAt}
+	if len(window) > maxComplexEventBuffer {
+		window = window[len(window)-maxComplexEventBuffer:]
+	}
+
+	var matched []*Event
+	switch m.pattern.Kind {
+	case AllOf:
+		matched = matchAllOf(window, m.pattern.Events)
+	case Sequence:
+		matched = matchSequence(window, m.pattern.Events)
+	case Count:
+		if len(window) >= m.pattern.Count {
+			for _, received := range window[len(window)-m.pattern.Count:] {
+				matched = append(matched, received.event)
+			}
+		}
+	}
+
+	if matched != nil {
+		// The matched events are consumed
+		delete(m.windows, key)
+	} else {
+		m.windows[key] = window
+	}
+	return matched
+}
+
+// evictExpired drops the events received more than a window before now, and the windows left empty, e.g. the ones
+// of the emitters that are not sending events anymore. It must be called with the mutex held.
+func (m *complexEventMatcher) evictExpired(now time.Time) {
+	for key, window := range m.windows {
+		start := 0
+		for start < len(window) && now.Sub(window[start].receivedAt) > m.pattern.Window {
+			start++
+		}
+		if start == len(window) {
+			delete(m.windows, key)
+		} else if start > 0 {
+			m.windows[key] = window[start:]
+		}
+	}
+}
+
+// matchAllOf returns the latest events of each name, in the order of the names, if all of them are in the window.
+// Each event matches a single name, so that a name given twice requires two events.
+func matchAllOf(window []receivedEvent, names []string) []*Event {
+	matched := make([]*Event, len(names))
+	for i := len(window) - 1; i >= 0; i-- {
+		for j, name := range names {
+			if matched[j] == nil && window[i].event.Name == name {
+				matched[j] = window[i].event
+				break
+			}
+		}
+	}
+	for _, event := range matched {
+		if event == nil {
+			return nil
+		}
+	}
+	return matched
+}
+
+// matchSequence returns the events of the sequence ending with the last event of the window, if any.
+// The latest occurrence of each event is taken, so that the sequence is as short as possible.
+func matchSequence(window []receivedEvent, names []string) []*Event {
+	matched := make([]*Event, len(names))
+	next := len(names) - 1
+	if window[len(window)-1].event.Name != names[next] {
+		return nil
+	}
+	for i := len(window) - 1; i >= 0 && next >= 0; i-- {
+		if window[i].event.Name == names[next] {
+			matched[next] = window[i].event
+			next--
+		}
+	}
+	if next >= 0 {
+		return nil
+	}
+	return matched
+}
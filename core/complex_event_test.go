@@ -0,0 +1,172 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComplexEventMatcher(t *testing.T) {
+	type step struct {
+		name    string
+		emitter string
+		at      int // milliseconds
+		// Indexes of the steps matched when this one is received, nil if no match
+		matched []int
+	}
+	tests := []struct {
+		name    string
+		pattern ComplexEventPattern
+		steps   []step
+		// Number of windows kept once the steps are received
+		windows int
+	}{
+		{
+			name:    "all of",
+			pattern: ComplexEventPattern{Kind: AllOf, Events: []string{"A", "B"}, Window: time.Second},
+			steps:   []step{{"B", "x", 0, nil}, {"A", "x", 500, []int{1, 0}}},
+		},
+		{
+			name:    "all of, latest occurrences",
+			pattern: ComplexEventPattern{Kind: AllOf, Events: []string{"A", "B"}, Window: time.Second},
+			steps:   []step{{"A", "x", 0, nil}, {"A", "x", 100, nil}, {"B", "x", 200, []int{1, 2}}},
+		},
+		{
+			name:    "all of, out of the window",
+			pattern: ComplexEventPattern{Kind: AllOf, Events: []string{"A", "B"}, Window: time.Second},
+			steps:   []step{{"A", "x", 0, nil}, {"B", "x", 1500, nil}, {"A", "x", 2000, []int{2, 1}}},
+			windows: 0,
+		},
+		{
+			name:    "all of, same event twice",
+			pattern: ComplexEventPattern{Kind: AllOf, Events: []string{"A", "B", "A"}, Window: time.Second},
+			steps:   []step{{"A", "x", 0, nil}, {"B", "x", 100, nil}, {"A", "x", 200, []int{2, 1, 0}}},
+		},
+		{
+			name:    "sequence",
+			pattern: ComplexEventPattern{Kind: Sequence, Events: []string{"A", "B"}, Window: time.Second},
+			steps:   []step{{"B", "x", 0, nil}, {"A", "x", 100, nil}, {"C", "x", 150, nil}, {"B", "x", 200, []int{1, 3}}},
+		},
+		{
+			name:    "sequence received out of order",
+			pattern: ComplexEventPattern{Kind: Sequence, Events: []string{"A", "B"}, Window: time.Second},
+			steps:   []step{{"B", "x", 200, nil}, {"A", "x", 100, []int{1, 0}}},
+		},
+		{
+			name:    "count",
+			pattern: ComplexEventPattern{Kind: Count, Events: []string{"A"}, Count: 3, Window: time.Second},
+			steps: []step{
+				{"A", "x", 0, nil}, {"A", "x", 400, nil}, {"A", "x", 800, []int{0, 1, 2}}, {"A", "x", 900, nil},
+			},
+			windows: 1,
+		},
+		{
+			name:    "sliding count",
+			pattern: ComplexEventPattern{Kind: Count, Events: []string{"A"}, Count: 3, Window: time.Second},
+			steps: []step{
+				{"A", "x", 0, nil}, {"A", "x", 600, nil}, {"A", "x", 1200, nil}, {"A", "x", 1300, []int{1, 2, 3}},
+			},
+		},
+		{
+			name: "same emitter",
+			pattern: ComplexEventPattern{
+				Kind: Count, Events: []string{"LOGIN_FAIL"}, Count: 2, Window: time.Second, SameEmitter: true,
+			},
+			steps: []step{
+				{"LOGIN_FAIL", "x", 0, nil}, {"LOGIN_FAIL", "y", 100, nil}, {"LOGIN_FAIL", "x", 200, []int{0, 2}},
+			},
+			windows: 1,
+		},
+		{
+			name: "expired emitters",
+			pattern: ComplexEventPattern{
+				Kind: Count, Events: []string{"LOGIN_FAIL"}, Count: 2, Window: time.Second, SameEmitter: true,
+			},
+			steps: []step{
+				{"LOGIN_FAIL", "x", 0, nil}, {"LOGIN_FAIL", "y", 100, nil}, {"LOGIN_FAIL", "z", 1500, nil},
+			},
+			windows: 1,
+		},
+	}
+	start := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pattern.validate(); err != nil {
+				t.Fatalf("invalid pattern: %v", err)
+			}
+			matcher := &complexEventMatcher{pattern: tt.pattern, windows: make(map[string][]receivedEvent)}
+			events := make([]*Event, len(tt.steps))
+			for i, step := range tt.steps {
+				events[i] = &Event{Name: step.name, Emitter: step.emitter}
+				matched := matcher.match(events[i], start.Add(time.Duration(step.at)*time.Millisecond))
+
+				var want []*Event
+				for _, index := range step.matched {
+					want = append(want, events[index])
+				}
+				if !reflect.DeepEqual(matched, want) {
+					t.Errorf("step %d: matched %v, want %v", i, matched, want)
+				}
+			}
+			if len(matcher.windows) != tt.windows {
+				t.Errorf("%d windows kept, want %d", len(matcher.windows), tt.windows)
+			}
+		})
+	}
+}
+
+func TestComplexEventPatternValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern ComplexEventPattern
+	}{
+		{"no events", ComplexEventPattern{Kind: AllOf, Window: time.Second}},
+		{"no window", ComplexEventPattern{Kind: AllOf, Events: []string{"A"}}},
+		{"no count", ComplexEventPattern{Kind: Count, Events: []string{"A"}, Window: time.Second}},
+		{"unknown kind", ComplexEventPattern{Kind: "any_of", Events: []string{"A"}, Window: time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pattern.validate(); err == nil {
+				t.Error("the pattern is accepted")
+			}
+		})
+	}
+}
+
+func TestOnComplexEventDo(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	n := newTestNode(t, "node", bus)
+	other := newTestNode(t, "other", bus)
+
+	received := make(chan *Event, 1)
+	_, err := n.OnComplexEventDo(ComplexEventPattern{
+		Name:   "ALERTS",
+		Kind:   AllOf,
+		Events: []string{"SENSOR_A_ALERT", "SENSOR_B_ALERT"},
+		Window: time.Second,
+	}, &Action{Name: "record", Do: func(event *Event) { received <- event }})
+	if err != nil {
+		t.Fatalf("could not register the pattern: %v", err)
+	}
+	startTestNode(n)
+	startTestNode(other)
+
+	for _, name := range []string{"SENSOR_A_ALERT", "SENSOR_B_ALERT"} {
+		if err := other.BroadcastEvent(name, ""); err != nil {
+			t.Fatalf("could not send the event: %v", err)
+		}
+	}
+	event := waitForEvent(t, received)
+	if event.Name != "ALERTS" || event.Emitter != "node" {
+		t.Errorf("received %s from %s, want ALERTS from node", event.Name, event.Emitter)
+	}
+	matched := event.MatchedEvents()
+	if len(matched) != 2 || matched[0].Name != "SENSOR_A_ALERT" || matched[1].Name != "SENSOR_B_ALERT" {
+		t.Fatalf("matched %v, want both alerts", matched)
+	}
+	if last := matched[1]; event.CausationId != last.Id {
+		t.Errorf("caused by %s, want %s", event.CausationId, last.Id)
+	}
+	expectNoEvent(t, received)
+}
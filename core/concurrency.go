@@ -0,0 +1,145 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// ConcurrencyMode defines how the executions of an action registered with OnEventDo (or OnPatternDo) are scheduled
+// when it is triggered while already running. It is only taken into account on the first action of a chain.
+type ConcurrencyMode string
+
+const (
+	// ConcurrencyDefault executes the action in the event dispatcher of the node: the events are handled one at a
+	// time, the actions registered for an event being executed in order before the next event is handled.
+	ConcurrencyDefault ConcurrencyMode = ""
+	// ConcurrencyParallel executes the action right away, even if previous executions are still running.
+	ConcurrencyParallel ConcurrencyMode = "parallel"
+	// ConcurrencySerial queues the triggers, the executions running one at a time in order.
+	ConcurrencySerial ConcurrencyMode = "serial"
+	// ConcurrencyDrop ignores the triggers received while the action is running.
+	ConcurrencyDrop ConcurrencyMode = "drop"
+	// ConcurrencyLatest keeps only the latest trigger received while the action is running, executed afterwards.
+	ConcurrencyLatest ConcurrencyMode = "latest"
+	// ConcurrencyDebounce executes the action with the latest trigger, once no trigger has been received for
+	// ConcurrencyWindow milliseconds.
+	ConcurrencyDebounce ConcurrencyMode = "debounce"
+	// ConcurrencyThrottle executes the action at most once every ConcurrencyWindow milliseconds, ignoring the
+	// triggers received in between.
+	ConcurrencyThrottle ConcurrencyMode = "throttle"
+)
+
+func (m ConcurrencyMode) isValid() bool {
+	switch m {
+	case ConcurrencyDefault, ConcurrencyParallel, ConcurrencySerial, ConcurrencyDrop, ConcurrencyLatest,
+		ConcurrencyDebounce, ConcurrencyThrottle:
+		return true
+	}
+	return false
+}
+
+// actionScheduler schedules the executions of an action according to its concurrency mode.
+// Except for ConcurrencyDefault, the executions do not block the event dispatcher of the node.
+type actionScheduler struct {
+	node   *Node
+	action *Action
+	mode   ConcurrencyMode
+	window time.Duration
+
+	mutex      sync.Mutex
+	running    bool
+	queue      []*Event
+	generation uint64
+	lastRun    time.Time
+}
+
+func newActionScheduler(node *Node, action *Action) *actionScheduler {
+	return &actionScheduler{
+		node:   node,
+		action: action,
+		mode:   action.Concurrency,
+		window: time.Duration(action.ConcurrencyWindow) * time.Millisecond,
+	}
+}
+
+func (s *actionScheduler) trigger(event *Event) {
+	switch s.mode {
+	case ConcurrencyParallel:
+		go s.node.ExecuteAction(s.action, event)
+	case ConcurrencySerial, ConcurrencyDrop, ConcurrencyLatest:
+		s.enqueue(event)
+	case ConcurrencyDebounce:
+		s.debounce(event)
+	case ConcurrencyThrottle:
+		s.throttle(event)
+	default:
+		s.node.ExecuteAction(s.action, event)
+	}
+}
+
+func (s *actionScheduler) enqueue(event *Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		s.running = true
+		go s.run(event)
+		return
+	}
+
+	switch s.mode {
+	case ConcurrencyDrop:
+		s.node.Logger.Debugf("%s is running, dropping trigger", s.action.Name)
+	case ConcurrencyLatest:
+		s.queue = []*Event{event}
+	default:
+		s.queue = append(s.queue, event)
+	}
+}
+
+// run executes the action, then the queued triggers, until the queue is empty.
+func (s *actionScheduler) run(event *Event) {
+	for {
+		s.node.ExecuteAction(s.action, event)
+
+		s.mutex.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			s.mutex.Unlock()
+			return
+		}
+		event = s.queue[0]
+		s.queue = s.queue[1:]
+		s.mutex.Unlock()
+	}
+}
+
+func (s *actionScheduler) debounce(event *Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The timers of the previous triggers are outdated by the new generation
+	s.generation++
+	generation := s.generation
+	time.AfterFunc(s.window, func() {
+		s.mutex.Lock()
+		outdated := generation != s.generation
+		s.mutex.Unlock()
+		if !outdated {
+			s.node.ExecuteAction(s.action, event)
+		}
+	})
+}
+
+func (s *actionScheduler) throttle(event *Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if !s.lastRun.IsZero() && now.Sub(s.lastRun) < s.window {
+		s.node.Logger.Debugf("%s is throttled, dropping trigger", s.action.Name)
+		return
+	}
+	s.lastRun = now
+	go s.node.ExecuteAction(s.action, event)
+}
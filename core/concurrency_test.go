@@ -0,0 +1,162 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingAction records the payloads of the events it is executed with, and the maximum number of concurrent
+// executions.
+type recordingAction struct {
+	mutex         sync.Mutex
+	payloads      []string
+	running       int
+	maxConcurrent int
+}
+
+func (r *recordingAction) do(event *Event) {
+	r.mutex.Lock()
+	r.payloads = append(r.payloads, event.Payload)
+	r.running++
+	if r.running > r.maxConcurrent {
+		r.maxConcurrent = r.running
+	}
+	r.mutex.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mutex.Lock()
+	r.running--
+	r.mutex.Unlock()
+}
+
+// wait waits for count executions, then makes sure no other execution happens.
+func (r *recordingAction) wait(t *testing.T, count int) ([]string, int) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		r.mutex.Lock()
+		done := len(r.payloads) >= count && r.running == 0
+		r.mutex.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d executions, want %d", len(r.payloads), count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.payloads...), r.maxConcurrent
+}
+
+func TestConcurrencyModes(t *testing.T) {
+	tests := []struct {
+		mode     ConcurrencyMode
+		window   int
+		executed []string
+		// Whether the executions overlap, with 4 triggers at once
+		concurrent bool
+	}{
+		{ConcurrencyDefault, 0, []string{"1", "2", "3", "4"}, false},
+		{ConcurrencyParallel, 0, []string{"1", "2", "3", "4"}, true},
+		{ConcurrencySerial, 0, []string{"1", "2", "3", "4"}, false},
+		{ConcurrencyDrop, 0, []string{"1"}, false},
+		{ConcurrencyLatest, 0, []string{"1", "4"}, false},
+		{ConcurrencyDebounce, 50, []string{"4"}, false},
+		{ConcurrencyThrottle, 1000, []string{"1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			n := newTestNode(t, "node", NewInMemoryEventBus())
+			recorder := &recordingAction{}
+			registered := n.newRegisteredAction(1, 0, &Action{
+				Name:              "record",
+				Do:                recorder.do,
+				Concurrency:       tt.mode,
+				ConcurrencyWindow: tt.window,
+			}, nil)
+
+			for _, payload := range []string{"1", "2", "3", "4"} {
+				registered.scheduler.trigger(&Event{Name: "PING", Payload: payload})
+			}
+
+			executed, maxConcurrent := recorder.wait(t, len(tt.executed))
+			if tt.concurrent {
+				sort.Strings(executed)
+			}
+			if !reflect.DeepEqual(executed, tt.executed) {
+				t.Errorf("executed %v, want %v", executed, tt.executed)
+			}
+			if concurrent := maxConcurrent > 1; concurrent != tt.concurrent {
+				t.Errorf("%d concurrent executions, want concurrent executions: %v", maxConcurrent, tt.concurrent)
+			}
+		})
+	}
+}
+
+func TestUnknownConcurrencyMode(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	registered := n.newRegisteredAction(1, 0, &Action{Name: "action", Concurrency: "sometimes"}, nil)
+	if registered.scheduler.mode != ConcurrencyDefault {
+		t.Errorf("mode = %s, want the default one", registered.scheduler.mode)
+	}
+}
+
+func TestConcurrencyModesThroughTheNetwork(t *testing.T) {
+	tests := []struct {
+		mode     ConcurrencyMode
+		executed []string
+		// Whether the next events wait for the executions
+		blocking bool
+	}{
+		{ConcurrencyDefault, []string{"1", "2", "3", "4"}, true},
+		{ConcurrencySerial, []string{"1", "2", "3", "4"}, false},
+		{ConcurrencyLatest, []string{"1", "4"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			bus := NewInMemoryEventBus()
+			emitter := newTestNode(t, "emitter", bus)
+			receiver := newTestNode(t, "receiver", bus)
+			recorder := &recordingAction{}
+			receiver.OnEventDo("PING", &Action{Name: "record", Do: recorder.do, Concurrency: tt.mode})
+			marks := make(chan int, 1)
+			receiver.OnEventDo("MARK", &Action{Name: "mark", Do: func(_ *Event) {
+				recorder.mutex.Lock()
+				defer recorder.mutex.Unlock()
+				marks <- len(recorder.payloads) - recorder.running
+			}})
+			startTestNode(emitter)
+			startTestNode(receiver)
+
+			for _, payload := range []string{"1", "2", "3", "4", ""} {
+				name := "PING"
+				if payload == "" {
+					name = "MARK"
+				}
+				if err := emitter.SendEventTo("receiver", name, payload); err != nil {
+					t.Fatalf("could not send the event: %v", err)
+				}
+			}
+
+			select {
+			case done := <-marks:
+				if blocking := done == len(tt.executed); blocking != tt.blocking {
+					t.Errorf("%d executions done before the next event, want blocking: %v", done, tt.blocking)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("the next event is not handled")
+			}
+			if executed, _ := recorder.wait(t, len(tt.executed)); !reflect.DeepEqual(executed, tt.executed) {
+				t.Errorf("executed %v, want %v", executed, tt.executed)
+			}
+		})
+	}
+}
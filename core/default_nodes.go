@@ -1,8 +1,12 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"strings"
 )
 
 // NewDefaultNode returns a Node with a default configuration. The only components available
@@ -13,20 +17,90 @@ func NewDefaultNode() *Node {
 
 	defaultHost := getFromEnvOrFail("RABBIT_MQ_HOST", info.Name)
 	registrationServer := getFromEnvOrFail("REGISTRATION_SERVER", info.Name)
-	rabbitMQEventNetwork := NewRabbitMQEventNetwork(ConnexionDetails{
+	rabbitMQEventNetwork := NewRabbitMQEventNetworkWithConfig(ConnexionDetails{
 		Username: getFromEnvOrFail("RABBIT_MQ_USERNAME", info.Name),
 		Password: getFromEnvOrFail("RABBIT_MQ_PASSWORD", info.Name),
 		Host:     defaultHost,
 		Port:     getFromEnvOrFail("RABBIT_MQ_PORT", info.Name),
-	})
+	}, rabbitMQConfigFromEnv())
 
 	rs := NewDefaultRegistrationServer(fmt.Sprintf("%s:4000", registrationServer))
 
-	return NewNode(info, DefaultNodeConfig(), logger, rs, rabbitMQEventNetwork, nil, nil)
+	n := NewNode(info, DefaultNodeConfig(), logger, rs, rabbitMQEventNetwork, nil, nil)
+	configureSecurityFromEnv(n)
+	loadScenarioFromEnv(n)
+	return n
 }
 
 func DefaultNodeConfig() NodeConfig {
 	return NodeConfig{
-		ExposeActions: true,
+		ExposeActions:       true,
+		RequireSignedEvents: os.Getenv("REQUIRE_SIGNED_EVENTS") == "true",
 	}
 }
+
+// configureSecurityFromEnv generates the encryption key pair of the node, sets its labels from NODE_LABELS
+// (comma separated) and its access-control policy from the JSON file POLICY_FILE, and sets up the signature
+// of the events with the HMAC key shared by all the nodes taken from EVENT_SIGNING_KEY, if set.
+func configureSecurityFromEnv(n *Node) {
+	keyPair, err := GenerateEncryptionKeyPair()
+	if err != nil {
+		n.Logger.Errorf("encrypted events will not be available: %v", err)
+	} else {
+		n.SetEncryptionKeyPair(keyPair)
+	}
+
+	if labels := os.Getenv("NODE_LABELS"); labels != "" {
+		for _, label := range strings.Split(labels, ",") {
+			n.Info.Labels = append(n.Info.Labels, strings.TrimSpace(label))
+		}
+	}
+
+	if policyFile := os.Getenv("POLICY_FILE"); policyFile != "" {
+		data, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			n.Logger.Fatalf("could not read policy: %v", err)
+		}
+		var policy Policy
+		if err := json.Unmarshal(data, &policy); err != nil {
+			n.Logger.Fatalf("could not parse policy %s: %v", policyFile, err)
+		}
+		if err := n.SetPolicy(&policy); err != nil {
+			n.Logger.Fatalf("%v", err)
+		}
+	}
+
+	key := os.Getenv("EVENT_SIGNING_KEY")
+	if key == "" {
+		return
+	}
+	hmacKey := NewHMACKey([]byte(key))
+	n.SetSigner(hmacKey)
+	n.TrustEmitter("*", hmacKey)
+}
+
+// loadScenarioFromEnv applies the scenario file SCENARIO_FILE (YAML or JSON), if set.
+func loadScenarioFromEnv(n *Node) {
+	if scenarioFile := os.Getenv("SCENARIO_FILE"); scenarioFile != "" {
+		if err := n.LoadScenario(scenarioFile); err != nil {
+			n.Logger.Fatalf("%v", err)
+		}
+	}
+}
+
+// rabbitMQConfigFromEnv returns the default RabbitMQConfig, with the routing mode
+// taken from RABBIT_MQ_ROUTING_MODE if set (fanout or topic), and the codec from EVENT_CODEC (json or cbor).
+func rabbitMQConfigFromEnv() RabbitMQConfig {
+	config := DefaultRabbitMQConfig()
+	if routingMode := os.Getenv("RABBIT_MQ_ROUTING_MODE"); routingMode != "" {
+		config.RoutingMode = RoutingMode(routingMode)
+	}
+	if codecName := os.Getenv("EVENT_CODEC"); codecName != "" {
+		codec, err := CodecByName(codecName)
+		if err != nil {
+			log.Fatalf("invalid EVENT_CODEC: %v", err)
+		}
+		config.Codec = codec
+	}
+	return config
+}
@@ -20,17 +20,19 @@ func NewDefaultRaspberryPiNode(listenForJoystickEvents bool) *Node {
 	defaultHost := getFromEnvOrFail("RABBIT_MQ_HOST", info.Name)
 	registrationServer := getFromEnvOrFail("REGISTRATION_SERVER", info.Name)
 
-	rabbitMQEventNetwork := NewRabbitMQEventNetwork(ConnexionDetails{
+	rabbitMQEventNetwork := NewRabbitMQEventNetworkWithConfig(ConnexionDetails{
 		Username: getFromEnvOrFail("RABBIT_MQ_USERNAME", info.Name),
 		Password: getFromEnvOrFail("RABBIT_MQ_PASSWORD", info.Name),
 		Host:     defaultHost,
 		Port:     getFromEnvOrFail("RABBIT_MQ_PORT", info.Name),
-	})
+	}, rabbitMQConfigFromEnv())
 
 	rs := NewDefaultRegistrationServer(fmt.Sprintf("%s:4000", registrationServer))
 	rpi := raspberrypi.NewRaspberryPiWithSenseHat(listenForJoystickEvents, logger)
 
 	n := NewNode(info, DefaultNodeConfig(), logger, rs, rabbitMQEventNetwork, nil, rpi)
+	configureSecurityFromEnv(n)
+	loadScenarioFromEnv(n)
 
 	hardwareEventHandler := func(e interface{}) {
 		inputEvent, ok := e.(raspberrypi.InputEvent)
@@ -41,9 +43,12 @@ func NewDefaultRaspberryPiNode(listenForJoystickEvents bool) *Node {
 			Name:     fmt.Sprintf("I_%s_%s", strings.ToUpper(inputEvent.Direction), strings.ToUpper(inputEvent.Action)),
 			Emitter:  fmt.Sprintf("%s-hardware", n.Info.Name),
 			Receiver: "*",
-			Payload:  fmt.Sprintf("{\"timestamp\": %d }", inputEvent.Timestamp.Unix()),
+			// The timestamp is kept in the payload for the handlers written before Event.Timestamp
+			Payload:   fmt.Sprintf("{\"timestamp\": %d }", inputEvent.Timestamp.Unix()),
+			Timestamp: inputEvent.Timestamp,
+			Version:   EventVersion,
 		}
-		n.handleEvent(event)
+		n.handleLocalEvent(event)
 	}
 
 	rpi.SetEventHandler(hardwareEventHandler)
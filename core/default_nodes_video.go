@@ -25,12 +25,12 @@ func NewDefaultNodeWithVideo() *Node {
 	defaultHost := getFromEnvOrFail("RABBIT_MQ_HOST", info.Name)
 	registrationServer := getFromEnvOrFail("REGISTRATION_SERVER", info.Name)
 
-	rabbitMQEventNetwork := NewRabbitMQEventNetwork(ConnexionDetails{
+	rabbitMQEventNetwork := NewRabbitMQEventNetworkWithConfig(ConnexionDetails{
 		Username: getFromEnvOrFail("RABBIT_MQ_USERNAME", info.Name),
 		Password: getFromEnvOrFail("RABBIT_MQ_PASSWORD", info.Name),
 		Host:     defaultHost,
 		Port:     getFromEnvOrFail("RABBIT_MQ_PORT", info.Name),
-	})
+	}, rabbitMQConfigFromEnv())
 
 	mediaController, err := vlc.NewVLCMediaController()
 	if err != nil {
@@ -39,31 +39,36 @@ func NewDefaultNodeWithVideo() *Node {
 
 	rs := NewDefaultRegistrationServer(fmt.Sprintf("%s:4000", registrationServer))
 	n := NewNode(info, DefaultNodeConfig(), logger, rs, rabbitMQEventNetwork, mediaController, nil)
+	configureSecurityFromEnv(n)
+	loadScenarioFromEnv(n)
 
 	if n.MediaController != nil {
 		// By default, we emit "internal" event when there is a media event
 		n.MediaController.SetOnMediaStartedCallback(func() {
-			n.handleEvent(&Event{
-				InternalMediaStarted,
-				fmt.Sprintf("%s.media-controller", n.Info.Name),
-				n.Info.Name,
-				"{}"})
+			n.handleLocalEvent(&Event{
+				Name:     InternalMediaStarted,
+				Emitter:  fmt.Sprintf("%s.media-controller", n.Info.Name),
+				Receiver: n.Info.Name,
+				Payload:  "{}",
+			})
 		})
 
 		n.MediaController.SetOnMediaPausedCallback(func() {
-			n.handleEvent(&Event{
-				InternalMediaPaused,
-				fmt.Sprintf("%s.media-controller", n.Info.Name),
-				n.Info.Name,
-				"{}"})
+			n.handleLocalEvent(&Event{
+				Name:     InternalMediaPaused,
+				Emitter:  fmt.Sprintf("%s.media-controller", n.Info.Name),
+				Receiver: n.Info.Name,
+				Payload:  "{}",
+			})
 		})
 
 		n.MediaController.SetOnMediaEndedCallback(func() {
-			n.handleEvent(&Event{
-				InternalMediaEnded,
-				fmt.Sprintf("%s.media-controller", n.Info.Name),
-				n.Info.Name,
-				"{}"})
+			n.handleLocalEvent(&Event{
+				Name:     InternalMediaEnded,
+				Emitter:  fmt.Sprintf("%s.media-controller", n.Info.Name),
+				Receiver: n.Info.Name,
+				Payload:  "{}",
+			})
 		})
 	}
 
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/nacl/box"
+	"sync"
+)
+
+const (
+	// ContentTypeEncrypted is the content type of the events whose payload is encrypted for their receiver.
+	ContentTypeEncrypted = "application/vnd.demokit.encrypted"
+	// EncryptedHeader is set on the events sent with SendEncryptedEventTo, and is kept once they are decrypted.
+	EncryptedHeader = "demokit-encrypted"
+
+	encryptionKeySize = 32
+)
+
+// EncryptionKeyPair is the key pair used to decrypt the events sent to a node. Its public key is distributed
+// to the other nodes through the registration server (see NodeInfo.PublicKey).
+type EncryptionKeyPair struct {
+	publicKey  *[encryptionKeySize]byte
+	privateKey *[encryptionKeySize]byte
+}
+
+func GenerateEncryptionKeyPair() (*EncryptionKeyPair, error) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate encryption key pair: %v", err)
+	}
+	return &EncryptionKeyPair{
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+// PublicKey returns the base64 encoded public key.
+func (k *EncryptionKeyPair) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.publicKey[:])
+}
+
+func parsePublicKey(encoded string) (*[encryptionKeySize]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed public key: %v", err)
+	}
+	if len(raw) != encryptionKeySize {
+		return nil, fmt.Errorf("invalid public key size %d, expected %d", len(raw), encryptionKeySize)
+	}
+	var key [encryptionKeySize]byte
+	copy(key[:], raw)
+	return &key, nil
+}
+
+// publicKeyCache holds the public keys of the other nodes, by node name.
+type publicKeyCache struct {
+	mutex sync.RWMutex
+	keys  map[string]*[encryptionKeySize]byte
+}
+
+func newPublicKeyCache() *publicKeyCache {
+	return &publicKeyCache{
+		keys: make(map[string]*[encryptionKeySize]byte),
+	}
+}
+
+func (c *publicKeyCache) get(nodeName string) (*[encryptionKeySize]byte, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	key, ok := c.keys[nodeName]
+	return key, ok
+}
+
+func (c *publicKeyCache) set(nodeName string, key *[encryptionKeySize]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.keys[nodeName] = key
+}
+
+// sealedPayload is the encrypted part of an event.
+type sealedPayload struct {
+	ContentType string `json:",omitempty"`
+	Payload     string `json:",omitempty"`
+	Data        []byte
+}
+
+// IsEncrypted returns true if the payload of the event is encrypted.
+func (e *Event) IsEncrypted() bool {
+	return e.ContentType == ContentTypeEncrypted
+}
+
+// SetEncryptionKeyPair sets the key pair used to decrypt the events sent to this node, and publishes its public key
+// in the node info. It must be called before the node is started to be registered with the public key.
+func (n *Node) SetEncryptionKeyPair(keyPair *EncryptionKeyPair) {
+	n.encryptionKeyPair = keyPair
+	n.Info.PublicKey = keyPair.PublicKey()
+}
+
+// SetNodePublicKey sets the public key of a node, for the setups without a registration server.
+func (n *Node) SetNodePublicKey(nodeName, publicKey string) error {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key for %s: %v", nodeName, err)
+	}
+	n.publicKeys.set(nodeName, key)
+	return nil
+}
+
+// RefreshPublicKeys fetches the public keys of the registered nodes from the registration server.
+func (n *Node) RefreshPublicKeys() error {
+	if n.RegistrationServer == nil {
+		return fmt.Errorf("no registration server configured")
+	}
+	nodes, err := n.RegistrationServer.FetchNodesInfo()
+	if err != nil {
+		return fmt.Errorf("could not fetch nodes info: %v", err)
+	}
+	for _, node := range nodes {
+		if node.NodeInfo.PublicKey == "" {
+			continue
+		}
+		if err := n.SetNodePublicKey(node.NodeInfo.Name, node.NodeInfo.PublicKey); err != nil {
+			n.Logger.Warnf("ignoring public key: %v", err)
+		}
+	}
+	return nil
+}
+
+// SendEncryptedEventTo sends an event to the receiver, its payload being encrypted with the public key of the
+// receiver so that only the receiver can read it. The keys of the nodes are fetched from the registration server
+// when unknown. An error is returned if the key of the receiver cannot be found.
+func (n *Node) SendEncryptedEventTo(receiver, eventName, payload string) error {
+	return n.emitEncryptedEvent(&Event{
+		Name:     eventName,
+		Receiver: receiver,
+		Payload:  payload,
+	})
+}
+
+// SendEncryptedBinaryTo is similar to SendEncryptedEventTo, for a binary payload.
+func (n *Node) SendEncryptedBinaryTo(receiver, eventName, contentType string, data []byte) error {
+	if contentType == "" {
+		contentType = ContentTypeOctetStream
+	}
+	return n.emitEncryptedEvent(&Event{
+		Name:        eventName,
+		Receiver:    receiver,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
+func (n *Node) emitEncryptedEvent(event *Event) error {
+	if event.Receiver == "" || event.Receiver == "*" {
+		return fmt.Errorf("cannot encrypt %s, encrypted events must have a single receiver", event.Name)
+	}
+
+	// The payload is validated before being encrypted, sendEvent cannot do it afterwards
+	n.prepareEvent(event)
+	if err := n.checkPolicy(event, true); err != nil {
+		n.Logger.Errorf("not sending event: %v", err)
+		return err
+	}
+	if err := n.schemas.Validate(SchemaEmitted, event); err != nil {
+		n.Logger.Errorf("not sending event: %v", err)
+		return err
+	}
+
+	if err := n.encryptEvent(event); err != nil {
+		n.Logger.Errorf("not sending event %s: %v", event.Name, err)
+		return err
+	}
+	return n.sendEvent(event)
+}
+
+func (n *Node) encryptEvent(event *Event) error {
+	key, ok := n.publicKeys.get(event.Receiver)
+	if !ok {
+		if err := n.RefreshPublicKeys(); err != nil {
+			return fmt.Errorf("public key of %s is unknown, and could not be refreshed: %v", event.Receiver, err)
+		}
+		if key, ok = n.publicKeys.get(event.Receiver); !ok {
+			return fmt.Errorf("public key of %s is unknown, the node may not be registered or may not support encryption",
+				event.Receiver)
+		}
+	}
+
+	plaintext, err := json.Marshal(sealedPayload{
+		ContentType: event.ContentType,
+		Payload:     event.Payload,
+		Data:        event.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode payload: %v", err)
+	}
+
+	sealed, err := box.SealAnonymous(nil, plaintext, key, rand.Reader)
+	if err != nil {
+		return fmt.Errorf("could not encrypt payload: %v", err)
+	}
+
+	event.Payload = ""
+	event.ContentType = ContentTypeEncrypted
+	event.Data = sealed
+	event.SetHeader(EncryptedHeader, "true")
+	return nil
+}
+
+// decryptEvent replaces the encrypted payload of the event by the decrypted one.
+func (n *Node) decryptEvent(event *Event) error {
+	if n.encryptionKeyPair == nil {
+		return fmt.Errorf("no encryption key pair set")
+	}
+
+	plaintext, ok := box.OpenAnonymous(nil, event.Data, n.encryptionKeyPair.publicKey, n.encryptionKeyPair.privateKey)
+	if !ok {
+		return fmt.Errorf("could not decrypt payload")
+	}
+
+	var payload sealedPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return fmt.Errorf("could not decode decrypted payload: %v", err)
+	}
+
+	event.ContentType = payload.ContentType
+	event.Payload = payload.Payload
+	event.Data = payload.Data
+	return nil
+}
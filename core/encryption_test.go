@@ -0,0 +1,120 @@
+package core
+
+import "testing"
+
+// newTestEncryptionNodes returns a sender knowing the public key of the receiver.
+func newTestEncryptionNodes(t *testing.T, bus *InMemoryEventBus) (*Node, *Node) {
+	t.Helper()
+	sender := newTestNode(t, "sender", bus)
+	receiver := newTestNode(t, "receiver", bus)
+	keyPair, err := GenerateEncryptionKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate the key pair: %v", err)
+	}
+	receiver.SetEncryptionKeyPair(keyPair)
+	if err := sender.SetNodePublicKey("receiver", receiver.Info.PublicKey); err != nil {
+		t.Fatalf("could not set the public key: %v", err)
+	}
+	return sender, receiver
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	sender, receiver := newTestEncryptionNodes(t, NewInMemoryEventBus())
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{"text", Event{Name: "SECRET", Payload: `{"code":1234}`}},
+		{"binary", Event{Name: "SECRET", ContentType: "image/png", Data: []byte{0x89, 'P', 0}}},
+		{"empty binary", Event{Name: "SECRET", ContentType: ContentTypeOctetStream, Data: []byte{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := tt.event
+			event.Receiver = "receiver"
+			if err := sender.encryptEvent(&event); err != nil {
+				t.Fatalf("could not encrypt the event: %v", err)
+			}
+			if !event.IsEncrypted() || event.Payload != "" || event.Header(EncryptedHeader) == "" {
+				t.Fatalf("encrypted %+v, want the payload hidden", event)
+			}
+
+			if err := receiver.decryptEvent(&event); err != nil {
+				t.Fatalf("could not decrypt the event: %v", err)
+			}
+			if event.ContentType != tt.event.ContentType || event.Payload != tt.event.Payload ||
+				event.IsBinary() != tt.event.IsBinary() || string(event.Data) != string(tt.event.Data) {
+				t.Errorf("decrypted %+v, want %+v", event, tt.event)
+			}
+		})
+	}
+}
+
+func TestDecryptionFailures(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	sender, receiver := newTestEncryptionNodes(t, bus)
+	otherKeyPair, err := GenerateEncryptionKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate the key pair: %v", err)
+	}
+	other := newTestNode(t, "other", bus)
+	other.SetEncryptionKeyPair(otherKeyPair)
+	noKey := newTestNode(t, "no-key", bus)
+
+	tests := []struct {
+		name     string
+		receiver *Node
+		tamper   func(event *Event)
+	}{
+		{"wrong key", other, nil},
+		{"no key pair", noKey, nil},
+		{"tampered ciphertext", receiver, func(event *Event) { event.Data[len(event.Data)-1] ^= 0xff }},
+		{"truncated ciphertext", receiver, func(event *Event) { event.Data = event.Data[:16] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{Name: "SECRET", Receiver: "receiver", Payload: "secret"}
+			if err := sender.encryptEvent(event); err != nil {
+				t.Fatalf("could not encrypt the event: %v", err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(event)
+			}
+			if err := tt.receiver.decryptEvent(event); err == nil {
+				t.Errorf("decrypted %+v", event)
+			}
+		})
+	}
+}
+
+func TestSendEncryptedEventTo(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	sender, receiver := newTestEncryptionNodes(t, bus)
+	handled := make(chan *Event, 1)
+	receiver.OnEventDo("SECRET", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	startTestNode(sender)
+	startTestNode(receiver)
+
+	if err := sender.SendEncryptedEventTo("receiver", "SECRET", `{"code":1234}`); err != nil {
+		t.Fatalf("could not send the event: %v", err)
+	}
+	event := waitForEvent(t, handled)
+	if event.Payload != `{"code":1234}` || event.IsEncrypted() || event.Header(EncryptedHeader) == "" {
+		t.Errorf("received %+v, want the decrypted payload", event)
+	}
+
+	tests := []struct {
+		name     string
+		receiver string
+	}{
+		{"broadcast", "*"},
+		{"unknown key", "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sender.SendEncryptedEventTo(tt.receiver, "SECRET", "secret"); err == nil {
+				t.Error("the event is sent")
+			}
+		})
+	}
+}
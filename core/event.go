@@ -1,8 +1,97 @@
 package core
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// EventVersion is the version of the Event envelope emitted by this version of the demokit.
+	EventVersion = 2
+
+	// LegacyEventVersion is the version given to events received from older nodes, whose envelope
+	// only contains the name, emitter, receiver and payload.
+	LegacyEventVersion = 1
+)
+
+// Event is the unit of communication between nodes.
+//
+// Id is unique to each event, and Timestamp is the time of emission. Both are set when the event is emitted by a Node.
+// CorrelationId identifies a conversation: it is set on the events sent with Node.Request and copied on the reply,
+// and can be propagated to the events emitted because of another one with SetCause. CausationId is the Id of the event
+// that caused this one. Headers can hold any additional metadata.
+//
+// The payload is either text (usually JSON) held in Payload, or binary data held in Data. ContentType is the
+// MIME type of the payload, an empty content type standing for a JSON Payload.
 type Event struct {
-	Name     string
-	Emitter  string
-	Receiver string
-	Payload  string
+	Name          string
+	Emitter       string
+	Receiver      string
+	Payload       string
+	ContentType   string `json:",omitempty"`
+	Data          []byte `json:",omitempty" cbor:"Data"`
+	Id            string
+	Timestamp     time.Time
+	CorrelationId string `json:",omitempty"`
+	CausationId   string `json:",omitempty"`
+	Version       int
+	Headers       map[string]string `json:",omitempty"`
+
+	// The events matched by a complex event pattern, see MatchedEvents
+	matched []*Event
+	// The time the event was received by the node, before being authenticated and dispatched
+	receivedAt time.Time
+}
+
+// SetCause records that the event is emitted because of the cause event.
+// The correlation id of the cause is propagated, or its id if it has none.
+func (e *Event) SetCause(cause *Event) {
+	if cause == nil {
+		return
+	}
+	e.CausationId = cause.Id
+	if cause.CorrelationId != "" {
+		e.CorrelationId = cause.CorrelationId
+	} else {
+		e.CorrelationId = cause.Id
+	}
+}
+
+// SetHeader sets the header key to value, creating the headers if needed.
+func (e *Event) SetHeader(key, value string) {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	e.Headers[key] = value
+}
+
+// Header returns the value of the header key, or an empty string if not set.
+func (e *Event) Header(key string) string {
+	return e.Headers[key]
+}
+
+// IsLegacy returns true if the event has been emitted by a node using the legacy envelope.
+func (e *Event) IsLegacy() bool {
+	return e.Version <= LegacyEventVersion
+}
+
+// normalize makes sure the envelope of a received event is valid, whatever the version of its emitter.
+func (e *Event) normalize() {
+	if e.Version == 0 {
+		e.Version = LegacyEventVersion
+	}
+}
+
+// newEventId returns a random identifier, suitable for identifying or correlating events.
+func newEventId() (string, error) {
+	return randomHexString(16)
+}
+
+func randomHexString(nBytes int) (string, error) {
+	b := make([]byte, nBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
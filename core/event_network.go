@@ -11,3 +11,38 @@ type EventNetwork interface {
 	StartListeningForEvents()
 	SetLogger(entry *log.Entry)
 }
+
+// NodeAwareEventNetwork is implemented by the event networks that need to know the name of the node
+// they are attached to, e.g. to only subscribe to the unicast events sent to this node.
+// SetNodeName is called by NewNode, before StartListeningForEvents.
+type NodeAwareEventNetwork interface {
+	EventNetwork
+	SetNodeName(name string)
+}
+
+// AllEvents can be given to SubscribingEventNetwork.Subscribe to receive all the broadcast events.
+const AllEvents = "*"
+
+// SubscribingEventNetwork is implemented by the event networks able to filter events before they reach the node.
+// Subscribe is called by the node for each event name it registers an action for, and the network must
+// deliver the broadcast events with that name, as well as all the unicast events sent to the node.
+// Unsubscribe is called once no action is registered for the event anymore.
+type SubscribingEventNetwork interface {
+	EventNetwork
+	Subscribe(eventName string)
+	Unsubscribe(eventName string)
+}
+
+type ConnectionState string
+
+const (
+	ConnectionStateConnecting   ConnectionState = "connecting"
+	ConnectionStateConnected    ConnectionState = "connected"
+	ConnectionStateDisconnected ConnectionState = "disconnected"
+)
+
+// ConnectionStateReporter is implemented by the event networks relying on a connection that can be lost,
+// so that the node can expose the state of its connection.
+type ConnectionStateReporter interface {
+	ConnectionState() ConnectionState
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// EventPattern selects the events an action is registered for, see OnPatternDo.
+// Name and Emitter are glob patterns (see path.Match), e.g. "I_*_PRESSED" or "*.media-controller",
+// or regular expressions if Regexp is true. Both must match the whole name, e.g. the regular expression "ALERT"
+// does not match SENSOR_ALERT, while "\w+_ALERT" does. An empty Emitter matches all the emitters.
+type EventPattern struct {
+	Name    string
+	Emitter string
+	Regexp  bool
+}
+
+func (p EventPattern) String() string {
+	s := p.Name
+	if p.Regexp {
+		s = "re:" + s
+	}
+	if p.Emitter != "" {
+		s += " from " + p.Emitter
+	}
+	return s
+}
+
+type eventMatcher struct {
+	pattern EventPattern
+	name    *regexp.Regexp
+	emitter *regexp.Regexp
+}
+
+func newEventMatcher(pattern EventPattern) (*eventMatcher, error) {
+	matcher := &eventMatcher{pattern: pattern}
+	if pattern.Regexp {
+		var err error
+		if matcher.name, err = compileAnchored(pattern.Name); err != nil {
+			return nil, fmt.Errorf("invalid event name pattern %s: %v", pattern.Name, err)
+		}
+		if pattern.Emitter != "" {
+			if matcher.emitter, err = compileAnchored(pattern.Emitter); err != nil {
+				return nil, fmt.Errorf("invalid emitter pattern %s: %v", pattern.Emitter, err)
+			}
+		}
+		return matcher, nil
+	}
+
+	if _, err := path.Match(pattern.Name, ""); err != nil {
+		return nil, fmt.Errorf("invalid event name pattern %s: %v", pattern.Name, err)
+	}
+	if _, err := path.Match(pattern.Emitter, ""); err != nil {
+		return nil, fmt.Errorf("invalid emitter pattern %s: %v", pattern.Emitter, err)
+	}
+	return matcher, nil
+}
+
+// compileAnchored compiles a regular expression matching whole strings only, as glob patterns do.
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func (m *eventMatcher) matches(event *Event) bool {
+	if m.pattern.Regexp {
+		return m.name.MatchString(event.Name) && (m.emitter == nil || m.emitter.MatchString(event.Emitter))
+	}
+	if ok, _ := path.Match(m.pattern.Name, event.Name); !ok {
+		return false
+	}
+	if m.pattern.Emitter == "" {
+		return true
+	}
+	ok, _ := path.Match(m.pattern.Emitter, event.Emitter)
+	return ok
+}
+
+// OnPatternDo registers an action to execute when an event matching the pattern is received.
+// When several actions match an event, they are executed by decreasing priority, the actions registered for the
+// exact name of the event before the ones registered with a pattern, and then in registration order.
+func (n *Node) OnPatternDo(pattern EventPattern, action *Action) (ActionId, error) {
+	return n.OnPatternDoWithPriority(pattern, 0, action)
+}
+
+// OnPatternDoWithPriority is similar to OnPatternDo, see OnEventDoWithPriority for the priority.
+func (n *Node) OnPatternDoWithPriority(pattern EventPattern, priority int, action *Action) (ActionId, error) {
+	matcher, err := newEventMatcher(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	n.actionsMutex.Lock()
+	n.lastActionId++
+	id := n.lastActionId
+	actions := append([]*registeredAction{}, n.patternActions...)
+	n.patternActions = append(actions, n.newRegisteredAction(id, priority, action, matcher))
+	n.actionsMutex.Unlock()
+
+	// The network cannot tell which events match the pattern
+	if subscribingNetwork, ok := n.EventNetwork.(SubscribingEventNetwork); ok {
+		subscribingNetwork.Subscribe(AllEvents)
+	}
+	n.Logger.Infof("action configured: %s -> %s (id: %d, priority: %d)", pattern, action.Name, id, priority)
+	return id, nil
+}
+
+// actionsFor returns the actions to execute for the event, in execution order.
+func (n *Node) actionsFor(event *Event) []*registeredAction {
+	n.actionsMutex.RLock()
+	defer n.actionsMutex.RUnlock()
+
+	actions := n.actions[event.Name]
+	matched := false
+	for _, registered := range n.patternActions {
+		if !registered.matcher.matches(event) {
+			continue
+		}
+		if !matched {
+			actions = append([]*registeredAction{}, actions...)
+			matched = true
+		}
+		actions = append(actions, registered)
+	}
+	if matched {
+		sortRegisteredActions(actions)
+	}
+	return actions
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventPatternMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern EventPattern
+		event   Event
+		matches bool
+	}{
+		{"glob", EventPattern{Name: "I_*_PRESSED"}, Event{Name: "I_BUTTON_PRESSED"}, true},
+		{"glob mismatch", EventPattern{Name: "I_*_PRESSED"}, Event{Name: "I_BUTTON_RELEASED"}, false},
+		{"glob whole name", EventPattern{Name: "I_*"}, Event{Name: "UI_BUTTON"}, false},
+		{"glob emitter", EventPattern{Name: "*", Emitter: "*.media"}, Event{Name: "PLAY", Emitter: "tv.media"}, true},
+		{"glob emitter mismatch", EventPattern{Name: "*", Emitter: "*.media"}, Event{Name: "PLAY", Emitter: "tv"}, false},
+		{"regexp", EventPattern{Name: `\w+_ALERT`, Regexp: true}, Event{Name: "SENSOR_ALERT"}, true},
+		{"regexp whole name", EventPattern{Name: "ALERT", Regexp: true}, Event{Name: "SENSOR_ALERT"}, false},
+		{"regexp alternation", EventPattern{Name: "START|STOP", Regexp: true}, Event{Name: "STOPPED"}, false},
+		{"regexp alternation match", EventPattern{Name: "START|STOP", Regexp: true}, Event{Name: "STOP"}, true},
+		{
+			"regexp emitter",
+			EventPattern{Name: ".*", Emitter: `sensor-\d+`, Regexp: true},
+			Event{Name: "PING", Emitter: "sensor-12"},
+			true,
+		},
+		{
+			"regexp emitter mismatch",
+			EventPattern{Name: ".*", Emitter: `sensor-\d+`, Regexp: true},
+			Event{Name: "PING", Emitter: "sensor-12-backup"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := newEventMatcher(tt.pattern)
+			if err != nil {
+				t.Fatalf("invalid pattern: %v", err)
+			}
+			if matches := matcher.matches(&tt.event); matches != tt.matches {
+				t.Errorf("matches = %v, want %v", matches, tt.matches)
+			}
+		})
+	}
+}
+
+func TestInvalidEventPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern EventPattern
+	}{
+		{"glob name", EventPattern{Name: "I_[A-"}},
+		{"glob emitter", EventPattern{Name: "*", Emitter: "[a-"}},
+		{"regexp name", EventPattern{Name: "I_(", Regexp: true}},
+		{"regexp emitter", EventPattern{Name: ".*", Emitter: "a)(b", Regexp: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newEventMatcher(tt.pattern); err == nil {
+				t.Error("the pattern is accepted")
+			}
+		})
+	}
+}
+
+func TestActionsForOrder(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	register := func(name string, priority int, pattern string) {
+		action := &Action{Name: name, Do: func(_ *Event) {}}
+		if pattern == "" {
+			n.OnEventDoWithPriority("I_BUTTON_PRESSED", priority, action)
+		} else if _, err := n.OnPatternDoWithPriority(EventPattern{Name: pattern}, priority, action); err != nil {
+			t.Fatalf("could not register %s: %v", name, err)
+		}
+	}
+	register("exact", 0, "")
+	register("pattern", 0, "I_*")
+	register("other pattern", 0, "O_*")
+	register("urgent pattern", 10, "*_PRESSED")
+	register("second exact", 0, "")
+	register("late", -1, "")
+
+	tests := []struct {
+		event   string
+		actions []string
+	}{
+		{"I_BUTTON_PRESSED", []string{"urgent pattern", "exact", "second exact", "pattern", "late"}},
+		{"I_BUTTON_RELEASED", []string{"pattern"}},
+		{"O_LED_ON", []string{"other pattern"}},
+		{"PING", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			var actions []string
+			for _, registered := range n.actionsFor(&Event{Name: tt.event}) {
+				actions = append(actions, registered.action.Name)
+			}
+			if !reflect.DeepEqual(actions, tt.actions) {
+				t.Errorf("actions = %v, want %v", actions, tt.actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxExecutionFailures = 50
+
+// ContextEventHandler is an EventHandler receiving the context of the execution, cancelled when the node stops
+// or when the execution is cancelled (see CancelExecution). Long-running handlers must return once it is done.
+// A handler returning an error fails the action: it is retried according to the RetryPolicy of the action, then
+// its OnError branch is executed instead of the rest of the chain.
+type ContextEventHandler func(ctx context.Context, event *Event) error
+
+// RetryPolicy defines how the handler of a failing action is retried. Attempts is the maximum number of attempts,
+// including the first one. The first retry happens after Backoff milliseconds, the delay being multiplied by
+// BackoffFactor (2 if not set) after each attempt, up to MaxBackoff milliseconds if set.
+type RetryPolicy struct {
+	Attempts      int
+	Backoff       int
+	BackoffFactor float64
+	MaxBackoff    int
+}
+
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	factor := p.BackoffFactor
+	if factor <= 0 {
+		factor = 2
+	}
+	delay := float64(p.Backoff)
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < float64(p.MaxBackoff)); i++ {
+		delay *= factor
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+type actionErrorKey struct{}
+
+// ActionError returns the error that caused the execution of the OnError branch the context is given to.
+func ActionError(ctx context.Context) error {
+	err, _ := ctx.Value(actionErrorKey{}).(error)
+	return err
+}
+
+// ExecutionId identifies a running execution of an action chain.
+type ExecutionId uint64
+
+// ExecutionInfo describes a running execution of an action chain, as listed by the node API.
+type ExecutionInfo struct {
+	Id        ExecutionId `json:"id"`
+	Action    string      `json:"action"`
+	Event     string      `json:"event,omitempty"`
+	StartedAt time.Time   `json:"started_at"`
+}
+
+// ExecutionFailure describes an execution of an action chain that failed, as listed by the node API.
+type ExecutionFailure struct {
+	ExecutionInfo
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type execution struct {
+	info   ExecutionInfo
+	cancel context.CancelFunc
+}
+
+// executions tracks the running executions of action chains, to cancel them, and the failed ones.
+type executions struct {
+	mutex          sync.Mutex
+	lastId         ExecutionId
+	running        map[ExecutionId]*execution
+	failures       []ExecutionFailure
+	actionFailures map[string]uint64
+}
+
+func newExecutions() *executions {
+	return &executions{
+		running:        make(map[ExecutionId]*execution),
+		actionFailures: make(map[string]uint64),
+	}
+}
+
+func (e *executions) start(parent context.Context, action *Action, event *Event) (context.Context, ExecutionId) {
+	ctx, cancel := context.WithCancel(parent)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lastId++
+	info := ExecutionInfo{
+		Id:        e.lastId,
+		Action:    action.Name,
+		StartedAt: time.Now().UTC(),
+	}
+	if event != nil {
+		info.Event = event.Name
+	}
+	e.running[info.Id] = &execution{info: info, cancel: cancel}
+	return ctx, info.Id
+}
+
+func (e *executions) end(id ExecutionId) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if running, ok := e.running[id]; ok {
+		running.cancel()
+		delete(e.running, id)
+	}
+}
+
+// fail records the failure of a running execution.
+func (e *executions) fail(id ExecutionId, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	running, ok := e.running[id]
+	if !ok {
+		return
+	}
+	e.failures = append(e.failures, ExecutionFailure{
+		ExecutionInfo: running.info,
+		Error:         err.Error(),
+		FailedAt:      time.Now().UTC(),
+	})
+	if len(e.failures) > maxExecutionFailures {
+		e.failures = e.failures[len(e.failures)-maxExecutionFailures:]
+	}
+}
+
+// countActionFailure counts the failures of an action, once its retries are exhausted.
+func (e *executions) countActionFailure(actionName string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.actionFailures[actionName]++
+}
+
+func (e *executions) failuresByAction() map[string]uint64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	failures := make(map[string]uint64, len(e.actionFailures))
+	for actionName, count := range e.actionFailures {
+		failures[actionName] = count
+	}
+	return failures
+}
+
+func (e *executions) lastFailures() []ExecutionFailure {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]ExecutionFailure{}, e.failures...)
+}
+
+func (e *executions) cancel(id ExecutionId) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	running, ok := e.running[id]
+	if ok {
+		running.cancel()
+	}
+	return ok
+}
+
+func (e *executions) list() []ExecutionInfo {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	infos := make([]ExecutionInfo, 0, len(e.running))
+	for _, running := range e.running {
+		infos = append(infos, running.info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id < infos[j].Id
+	})
+	return infos
+}
+
+// Context returns the context of the node, cancelled when the node stops.
+func (n *Node) Context() context.Context {
+	return n.ctx
+}
+
+// CancelExecution cancels a running execution of an action chain: its delays and repeats are interrupted,
+// the context given to its handlers is cancelled, and the rest of the chain is not executed.
+// It returns false if no such execution is running.
+func (n *Node) CancelExecution(id ExecutionId) bool {
+	if !n.executions.cancel(id) {
+		return false
+	}
+	n.Logger.Infof("execution %d cancelled", id)
+	return true
+}
+
+// RunningExecutions returns the executions of action chains currently running.
+func (n *Node) RunningExecutions() []ExecutionInfo {
+	return n.executions.list()
+}
+
+// FailedExecutions returns the last executions of action chains that failed.
+func (n *Node) FailedExecutions() []ExecutionFailure {
+	return n.executions.lastFailures()
+}
+
+// ServeExecutions serves the running executions on /executions, and allows to cancel them with
+// DELETE /executions/:id. The last failed executions are served on /executions/failures.
+func (n *Node) ServeExecutions() {
+	n.Router.GET("/executions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, n.RunningExecutions())
+	})
+
+	n.Router.GET("/executions/failures", func(c *gin.Context) {
+		c.JSON(http.StatusOK, n.FailedExecutions())
+	})
+
+	n.Router.DELETE("/executions/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid execution id")
+			return
+		}
+		if !n.CancelExecution(ExecutionId(id)) {
+			c.String(http.StatusNotFound, "no running execution with id %d", id)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// runHandler runs the handler of the action, retrying it according to its RetryPolicy.
+// Panics are recovered and reported as errors.
+func (n *Node) runHandler(ctx context.Context, action *Action, event *Event) error {
+	attempts := 1
+	if action.Retry != nil && action.Retry.Attempts > 1 {
+		attempts = action.Retry.Attempts
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = callHandler(ctx, action, event); err == nil || ctx.Err() != nil {
+			return err
+		}
+		if attempt < attempts {
+			delay := action.Retry.delay(attempt)
+			n.Logger.Warnf("%s failed (attempt %d/%d), retrying in %s: %v", action.Name, attempt, attempts, delay, err)
+			if !sleepContext(ctx, delay) {
+				return nil
+			}
+		}
+	}
+
+	n.executions.countActionFailure(action.Name)
+	return fmt.Errorf("%s failed: %v", action.Name, err)
+}
+
+func callHandler(ctx context.Context, action *Action, event *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if action.DoContext != nil {
+		return action.DoContext(ctx, event)
+	}
+	if action.Do != nil {
+		action.Do(event)
+	}
+	return nil
+}
+
+// sleepContext waits for the duration, and returns false if the context is done before.
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
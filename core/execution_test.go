@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		delays []time.Duration
+	}{
+		{"default factor", RetryPolicy{Backoff: 10}, []time.Duration{10, 20, 40}},
+		{"factor", RetryPolicy{Backoff: 10, BackoffFactor: 3}, []time.Duration{10, 30, 90}},
+		{"max backoff", RetryPolicy{Backoff: 10, MaxBackoff: 25}, []time.Duration{10, 20, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.delays {
+				if delay := tt.policy.delay(i + 1); delay != want*time.Millisecond {
+					t.Errorf("attempt %d: delay = %s, want %s", i+1, delay, want*time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+// failingAction fails the given number of times before succeeding, and counts its attempts.
+type failingAction struct {
+	failures int
+	attempts int
+}
+
+func (f *failingAction) do(_ context.Context, _ *Event) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return fmt.Errorf("failure %d", f.attempts)
+	}
+	return nil
+}
+
+func TestActionRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		onError   bool
+		attempts  int
+		executed  []string
+		actionErr string
+		// Whether the execution is reported as failed
+		failed bool
+	}{
+		{"success after retries", 2, true, 3, []string{"then"}, "", false},
+		{"attempt limit", 5, true, 3, []string{"on error"}, "failure 3", false},
+		{"attempt limit without on error", 5, false, 3, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNode(t, "node", NewInMemoryEventBus())
+			var executed []string
+			var actionErr error
+			failing := &failingAction{failures: tt.failures}
+			action := &Action{
+				Name:      "flaky",
+				DoContext: failing.do,
+				Retry:     &RetryPolicy{Attempts: 3, Backoff: 10},
+				Then:      &Action{Name: "then", Do: func(_ *Event) { executed = append(executed, "then") }},
+			}
+			if tt.onError {
+				action.OnError = &Action{Name: "on error", DoContext: func(ctx context.Context, _ *Event) error {
+					executed = append(executed, "on error")
+					actionErr = ActionError(ctx)
+					return nil
+				}}
+			}
+
+			start := time.Now()
+			n.ExecuteAction(action, &Event{Name: "PING"})
+			// Waiting 10ms, then 20ms between the attempts
+			if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+				t.Errorf("executed in %s, without waiting between the attempts", elapsed)
+			}
+			if failing.attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", failing.attempts, tt.attempts)
+			}
+			if !reflect.DeepEqual(executed, tt.executed) {
+				t.Errorf("executed %v, want %v", executed, tt.executed)
+			}
+			if tt.actionErr != "" && (actionErr == nil || !strings.Contains(actionErr.Error(), tt.actionErr)) {
+				t.Errorf("action error = %v, want %s", actionErr, tt.actionErr)
+			}
+
+			wantCount := uint64(0)
+			if tt.failures >= tt.attempts {
+				wantCount = 1
+			}
+			if count := n.executions.failuresByAction()["flaky"]; count != wantCount {
+				t.Errorf("%d failures counted, want %d", count, wantCount)
+			}
+			if failed := len(n.FailedExecutions()) > 0; failed != tt.failed {
+				t.Errorf("failures = %+v, want failed: %v", n.FailedExecutions(), tt.failed)
+			}
+		})
+	}
+}
+
+func TestCancelExecutionThroughTheAPI(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	cancelled := make(chan *Event, 1)
+	then := make(chan *Event, 1)
+	action := &Action{
+		Name: "wait",
+		DoContext: func(ctx context.Context, event *Event) error {
+			<-ctx.Done()
+			cancelled <- event
+			return ctx.Err()
+		},
+		Then: &Action{Name: "then", Do: func(event *Event) { then <- event }},
+	}
+	go n.ExecuteAction(action, &Event{Name: "PING"})
+
+	var running []ExecutionInfo
+	deadline := time.Now().Add(testTimeout)
+	for len(running) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the execution is not running")
+		}
+		time.Sleep(5 * time.Millisecond)
+		running = n.RunningExecutions()
+	}
+	if running[0].Action != "wait" || running[0].Event != "PING" {
+		t.Errorf("running = %+v, want wait, for PING", running)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"running execution", fmt.Sprint(running[0].Id), http.StatusNoContent},
+		{"cancelled execution", fmt.Sprint(running[0].Id), http.StatusNotFound},
+		{"invalid id", "first", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.status == http.StatusNotFound {
+				// The execution ends once its handler returns
+				waitForEvent(t, cancelled)
+				waitForExecutionsEnd(t, n)
+			}
+			recorder := httptest.NewRecorder()
+			n.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/executions/"+tt.id, nil))
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+		})
+	}
+
+	expectNoEvent(t, then)
+	if failures := n.FailedExecutions(); len(failures) != 0 {
+		t.Errorf("failures = %+v, the cancellation is reported as a failure", failures)
+	}
+}
+
+func waitForExecutionsEnd(t *testing.T, n *Node) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for len(n.RunningExecutions()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("running = %+v, want none", n.RunningExecutions())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
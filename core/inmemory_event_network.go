@@ -0,0 +1,174 @@
+package core
+
+import (
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// InMemoryEventBus is a process-local bus shared by several InMemoryEventNetwork. It allows to run
+// several nodes in the same binary (rehearsals, tests...) without any broker.
+type InMemoryEventBus struct {
+	mutex    sync.RWMutex
+	networks []*InMemoryEventNetwork
+}
+
+func NewInMemoryEventBus() *InMemoryEventBus {
+	return &InMemoryEventBus{
+		networks: make([]*InMemoryEventNetwork, 0),
+	}
+}
+
+func (b *InMemoryEventBus) attach(network *InMemoryEventNetwork) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.networks = append(b.networks, network)
+}
+
+func (b *InMemoryEventBus) detach(network *InMemoryEventNetwork) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, n := range b.networks {
+		if n == network {
+			b.networks = append(b.networks[:i], b.networks[i+1:]...)
+			return
+		}
+	}
+}
+
+// publish delivers a copy of the event to every network attached to the bus, including the emitter's one.
+// Filtering on the emitter and the receiver is left to the node, as with the RabbitMQEventNetwork.
+func (b *InMemoryEventBus) publish(event *Event) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, n := range b.networks {
+		n.enqueue(copyEvent(event))
+	}
+}
+
+// copyEvent returns a copy of the event as it would be decoded by a receiver: the data and the headers are not
+// shared, and the state set by the node that handled the event is not kept.
+func copyEvent(event *Event) *Event {
+	eventCopy := *event
+	if event.Data != nil {
+		eventCopy.Data = append([]byte{}, event.Data...)
+	}
+	if event.Headers != nil {
+		eventCopy.Headers = make(map[string]string, len(event.Headers))
+		for key, value := range event.Headers {
+			eventCopy.Headers[key] = value
+		}
+	}
+	eventCopy.matched = nil
+	eventCopy.receivedAt = time.Time{}
+	return &eventCopy
+}
+
+// InMemoryEventNetwork is an EventNetwork delivering events through an InMemoryEventBus.
+// Each network delivers events to its callback sequentially, in the order they were published,
+// from its own goroutine started by StartListeningForEvents.
+type InMemoryEventNetwork struct {
+	bus                   *InMemoryEventBus
+	eventReceivedCallBack EventHandler
+	logger                *log.Entry
+
+	mutex     sync.Mutex
+	queue     []*Event
+	signal    chan struct{}
+	listening bool
+	closed    bool
+}
+
+func NewInMemoryEventNetwork(bus *InMemoryEventBus) *InMemoryEventNetwork {
+	network := &InMemoryEventNetwork{
+		bus:    bus,
+		logger: log.WithField("node", "na-event-network-setup").WithField("component", "event-network"),
+		queue:  make([]*Event, 0),
+		signal: make(chan struct{}, 1),
+	}
+	bus.attach(network)
+	return network
+}
+
+func (m *InMemoryEventNetwork) BroadcastEvent(event *Event) {
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+	m.bus.publish(event)
+}
+
+func (m *InMemoryEventNetwork) SendEventTo(receiver string, event *Event) {
+	event.Receiver = receiver
+	m.BroadcastEvent(event)
+}
+
+func (m *InMemoryEventNetwork) SetReceivedEventCallback(handler EventHandler) {
+	m.eventReceivedCallBack = handler
+}
+
+// StartListeningForEvents starts delivering events to the callback. Events published on the bus
+// before this call are not delivered, as a RabbitMQ queue would not have received them either.
+func (m *InMemoryEventNetwork) StartListeningForEvents() {
+	m.mutex.Lock()
+	if m.listening || m.closed {
+		m.mutex.Unlock()
+		return
+	}
+	m.listening = true
+	m.mutex.Unlock()
+
+	go func() {
+		for range m.signal {
+			for {
+				m.mutex.Lock()
+				if len(m.queue) == 0 {
+					m.mutex.Unlock()
+					break
+				}
+				event := m.queue[0]
+				m.queue[0] = nil
+				m.queue = m.queue[1:]
+				m.mutex.Unlock()
+
+				if m.eventReceivedCallBack != nil {
+					m.eventReceivedCallBack(event)
+				}
+			}
+		}
+	}()
+
+	m.logger.Info("Listening for events...")
+}
+
+func (m *InMemoryEventNetwork) SetLogger(logger *log.Entry) {
+	m.logger = logger
+}
+
+// Close detaches the network from its bus and stops the delivery of events.
+func (m *InMemoryEventNetwork) Close() {
+	m.bus.detach(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.queue = nil
+	close(m.signal)
+}
+
+func (m *InMemoryEventNetwork) enqueue(event *Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.listening || m.closed {
+		return
+	}
+	m.queue = append(m.queue, event)
+
+	// Waking up the delivery goroutine, if it is not already awake
+	select {
+	case m.signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInMemoryEventNetworkDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		receiver     string
+		listening    bool
+		closed       bool
+		delivered    bool
+		wantReceiver string
+	}{
+		{"broadcast", "", true, false, true, "*"},
+		{"unicast", "b", true, false, true, "b"},
+		{"unicast to another node", "c", true, false, true, "c"},
+		{"not listening", "", false, false, false, ""},
+		{"closed", "", true, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewInMemoryEventBus()
+			a := NewInMemoryEventNetwork(bus)
+			b := NewInMemoryEventNetwork(bus)
+			defer a.Close()
+			defer b.Close()
+			aEvents := receiveEvents(a)
+			bEvents := receiveEvents(b)
+			a.StartListeningForEvents()
+			if tt.listening {
+				b.StartListeningForEvents()
+			}
+			if tt.closed {
+				b.Close()
+			}
+
+			event := &Event{Name: "PING", Emitter: "a"}
+			if tt.receiver == "" {
+				a.BroadcastEvent(event)
+			} else {
+				a.SendEventTo(tt.receiver, event)
+			}
+
+			// The filtering is left to the node, the emitter receives its own events
+			if received := waitForEvent(t, aEvents); received.Name != "PING" {
+				t.Errorf("emitter received %s, want PING", received.Name)
+			}
+			if !tt.delivered {
+				expectNoEvent(t, bEvents)
+				return
+			}
+			received := waitForEvent(t, bEvents)
+			if received.Receiver != tt.wantReceiver {
+				t.Errorf("receiver = %s, want %s", received.Receiver, tt.wantReceiver)
+			}
+			if received == event {
+				t.Error("the event is not copied")
+			}
+		})
+	}
+}
+
+func TestInMemoryEventNetworkOrder(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	a := NewInMemoryEventNetwork(bus)
+	b := NewInMemoryEventNetwork(bus)
+	defer a.Close()
+	defer b.Close()
+	events := receiveEvents(b)
+	b.StartListeningForEvents()
+
+	data := []byte{1, 2, 3}
+	for i := 0; i < 20; i++ {
+		a.BroadcastEvent(&Event{Name: fmt.Sprintf("EVENT_%d", i), Data: data})
+	}
+	for i := 0; i < 20; i++ {
+		received := waitForEvent(t, events)
+		if want := fmt.Sprintf("EVENT_%d", i); received.Name != want {
+			t.Fatalf("received %s, want %s", received.Name, want)
+		}
+		if !bytes.Equal(received.Data, data) {
+			t.Fatalf("data = %v, want %v", received.Data, data)
+		}
+		received.Data[0] = 42
+	}
+	if data[0] != 1 {
+		t.Error("the data of the event is shared with the receivers")
+	}
+}
+
+func TestInMemoryEventNetworkCopiesHeaders(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	a := NewInMemoryEventNetwork(bus)
+	b := NewInMemoryEventNetwork(bus)
+	defer a.Close()
+	defer b.Close()
+	aEvents := receiveEvents(a)
+	bEvents := receiveEvents(b)
+	a.StartListeningForEvents()
+	b.StartListeningForEvents()
+
+	event := &Event{Name: "ALERT", Headers: map[string]string{"source": "sensor"}}
+	event.matched = []*Event{{Name: "PING"}}
+	event.receivedAt = time.Now()
+	a.BroadcastEvent(event)
+
+	for _, events := range []<-chan *Event{aEvents, bEvents} {
+		received := waitForEvent(t, events)
+		if received.Header("source") != "sensor" {
+			t.Errorf("headers = %v, want the source", received.Headers)
+		}
+		if received.matched != nil || !received.receivedAt.IsZero() {
+			t.Error("the state of the emitter is kept")
+		}
+		received.SetHeader("source", "changed")
+	}
+	if event.Header("source") != "sensor" {
+		t.Error("the headers of the event are shared with the receivers")
+	}
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MQTTEventsTopic is the root of all the topics used by the MQTTEventNetwork.
+	// Broadcast events are published on MQTTEventsTopic/broadcast, and unicast events
+	// on MQTTEventsTopic/node/<receiver>, "/", "+" and "#" being replaced by "_" in the receiver.
+	MQTTEventsTopic = "events"
+
+	mqttQoS            = 1
+	mqttConnectTimeout = 10 * time.Second
+)
+
+// MQTTEventNetwork is an EventNetwork relying on an MQTT broker. Events are JSON encoded, exactly
+// as with the RabbitMQEventNetwork, so that microcontrollers can easily produce and consume them.
+// As MQTT 3.1.1 messages cannot carry a content type, the codec of the received events is detected from their
+// content. With the JSONCodec, the events with a binary payload are sent as binary envelopes (see
+// encodeBinaryEnvelope), so that their data is not base64 encoded.
+type MQTTEventNetwork struct {
+	client                mqtt.Client
+	codec                 Codec
+	eventReceivedCallBack EventHandler
+	logger                *log.Entry
+
+	mutex     sync.Mutex
+	nodeName  string
+	listening bool
+}
+
+// NewMQTTEventNetwork connects to the MQTT broker described by connDetails. Username and Password
+// can be left empty if the broker allows anonymous connections.
+func NewMQTTEventNetwork(connDetails ConnexionDetails) *MQTTEventNetwork {
+	return NewMQTTEventNetworkWithCodec(connDetails, JSONCodec)
+}
+
+// NewMQTTEventNetworkWithCodec is similar to NewMQTTEventNetwork, the events being sent with the given codec.
+func NewMQTTEventNetworkWithCodec(connDetails ConnexionDetails, codec Codec) *MQTTEventNetwork {
+	logger := log.WithField("node", "na-event-network-setup")
+
+	network := &MQTTEventNetwork{
+		codec:  codec,
+		logger: logger.WithField("component", "event-network"),
+	}
+
+	clientId, err := randomHexString(8)
+	if err != nil {
+		logger.Fatalf("could not generate MQTT client id: %v", err)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(fmt.Sprintf("tcp://%s:%s", connDetails.Host, connDetails.Port)).
+		SetClientID(fmt.Sprintf("demokit-%s", clientId)).
+		SetUsername(connDetails.Username).
+		SetPassword(connDetails.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(mqttConnectTimeout).
+		SetOnConnectHandler(network.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			network.getLogger().Warnf("connection to MQTT broker lost: %v", err)
+		})
+
+	network.client = mqtt.NewClient(opts)
+	token := network.client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		logger.Fatalf("failed to connect to MQTT broker: timeout")
+	}
+	if err := token.Error(); err != nil {
+		logger.Fatalf("failed to connect to MQTT broker: %v", err)
+	}
+
+	return network
+}
+
+func (m *MQTTEventNetwork) BroadcastEvent(event *Event) {
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+
+	var data []byte
+	var err error
+	if m.codec == JSONCodec && event.IsBinary() {
+		data, err = encodeBinaryEnvelope(event)
+	} else {
+		data, err = m.codec.Encode(event)
+	}
+	if err != nil {
+		m.getLogger().Errorf("could not marshal event: %v", err)
+		return
+	}
+
+	topic := mqttTopicFor(event.Receiver)
+	token := m.client.Publish(topic, mqttQoS, false, data)
+
+	// Waiting for the acknowledgement must not happen in the caller: when called from an event
+	// callback, it would block the MQTT client router and the acknowledgement would never be processed.
+	go func() {
+		token.Wait()
+		if err := token.Error(); err != nil {
+			m.getLogger().Errorf("could not send event on %s: %v", topic, err)
+		}
+	}()
+}
+
+func (m *MQTTEventNetwork) SendEventTo(receiver string, event *Event) {
+	event.Receiver = receiver
+	m.BroadcastEvent(event)
+}
+
+func (m *MQTTEventNetwork) SetReceivedEventCallback(handler EventHandler) {
+	m.eventReceivedCallBack = handler
+}
+
+func (m *MQTTEventNetwork) SetNodeName(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nodeName = name
+}
+
+func (m *MQTTEventNetwork) StartListeningForEvents() {
+	m.mutex.Lock()
+	m.listening = true
+	m.mutex.Unlock()
+
+	if err := m.subscribe(); err != nil {
+		m.getLogger().Fatalf("failed to subscribe to events: %v", err)
+	}
+
+	m.getLogger().Info("Listening for events...")
+}
+
+func (m *MQTTEventNetwork) SetLogger(logger *log.Entry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.logger = logger
+}
+
+// getLogger returns the logger, which may be set while the MQTT client is calling the handlers.
+func (m *MQTTEventNetwork) getLogger() *log.Entry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.logger
+}
+
+// onConnect is called on the first connection and after every automatic reconnection.
+// As sessions are not persisted by the broker, subscriptions have to be renewed.
+func (m *MQTTEventNetwork) onConnect(_ mqtt.Client) {
+	m.mutex.Lock()
+	listening := m.listening
+	logger := m.logger
+	m.mutex.Unlock()
+
+	logger.Debug("connected to MQTT broker")
+	if !listening {
+		return
+	}
+
+	if err := m.subscribe(); err != nil {
+		logger.Errorf("failed to renew subscriptions: %v", err)
+	}
+}
+
+func (m *MQTTEventNetwork) subscribe() error {
+	m.mutex.Lock()
+	nodeName := m.nodeName
+	logger := m.logger
+	m.mutex.Unlock()
+
+	filters := map[string]byte{
+		mqttTopicFor("*"): mqttQoS,
+	}
+	if nodeName != "" {
+		filters[mqttTopicFor(nodeName)] = mqttQoS
+	} else {
+		logger.Warn("node name unknown, only subscribing to broadcast events")
+	}
+
+	token := m.client.SubscribeMultiple(filters, m.onMessage)
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		return fmt.Errorf("subscription timeout")
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+
+	for topic := range filters {
+		logger.Debugf("subscribed to %s", topic)
+	}
+	return nil
+}
+
+func (m *MQTTEventNetwork) onMessage(_ mqtt.Client, msg mqtt.Message) {
+	event, err := decodeMQTTMessage(msg.Payload())
+	if err != nil {
+		m.getLogger().Warnf("could not unmarshal event received on %s: %v", msg.Topic(), err)
+		return
+	}
+
+	if m.eventReceivedCallBack != nil {
+		m.eventReceivedCallBack(event)
+	}
+}
+
+func decodeMQTTMessage(payload []byte) (*Event, error) {
+	if codec, err := detectCodec(payload); err == nil {
+		return codec.Decode(payload)
+	}
+	return decodeBinaryEnvelope(payload)
+}
+
+func mqttTopicFor(receiver string) string {
+	if receiver == "*" || receiver == "" {
+		return fmt.Sprintf("%s/broadcast", MQTTEventsTopic)
+	}
+	return fmt.Sprintf("%s/node/%s", MQTTEventsTopic, mqttTopicLevel(receiver))
+}
+
+// mqttTopicLevel makes sure a node name is a single level of a topic, without wildcards.
+func mqttTopicLevel(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
@@ -0,0 +1,315 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// mqttTestBroker is a minimal MQTT 3.1.1 broker, supporting what the MQTTEventNetwork relies on: exact topic
+// subscriptions, and publications with QoS 0 or 1. Messages are forwarded with QoS 0.
+type mqttTestBroker struct {
+	listener net.Listener
+
+	mutex   sync.Mutex
+	clients map[*mqttTestClient]bool
+}
+
+type mqttTestClient struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+	subscribed map[string]bool
+}
+
+func newMQTTTestBroker(t *testing.T) *mqttTestBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start the MQTT broker: %v", err)
+	}
+	broker := &mqttTestBroker{
+		listener: listener,
+		clients:  make(map[*mqttTestClient]bool),
+	}
+	go broker.accept()
+	t.Cleanup(broker.close)
+	return broker
+}
+
+func (b *mqttTestBroker) connexionDetails() ConnexionDetails {
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	return ConnexionDetails{Host: host, Port: port}
+}
+
+func (b *mqttTestBroker) close() {
+	b.listener.Close()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for client := range b.clients {
+		client.conn.Close()
+	}
+}
+
+func (b *mqttTestBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		client := &mqttTestClient{conn: conn, subscribed: make(map[string]bool)}
+		b.mutex.Lock()
+		b.clients[client] = true
+		b.mutex.Unlock()
+		go b.serve(client)
+	}
+}
+
+func (b *mqttTestBroker) serve(client *mqttTestClient) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.clients, client)
+		b.mutex.Unlock()
+		client.conn.Close()
+	}()
+
+	reader := bufio.NewReader(client.conn)
+	for {
+		header, body, err := readMQTTPacket(reader)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			client.write(0x20, []byte{0, 0})
+		case 3: // PUBLISH
+			qos := (header >> 1) & 3
+			topic, rest := readMQTTString(body)
+			if qos > 0 {
+				client.write(0x40, rest[:2])
+				rest = rest[2:]
+			}
+			b.forward(topic, rest)
+		case 8: // SUBSCRIBE
+			packetId, rest := body[:2], body[2:]
+			granted := append([]byte{}, packetId...)
+			for len(rest) > 0 {
+				var topic string
+				topic, rest = readMQTTString(rest)
+				granted = append(granted, rest[0])
+				rest = rest[1:]
+				b.mutex.Lock()
+				client.subscribed[topic] = true
+				b.mutex.Unlock()
+			}
+			client.write(0x90, granted)
+		case 10: // UNSUBSCRIBE
+			packetId, rest := body[:2], body[2:]
+			for len(rest) > 0 {
+				var topic string
+				topic, rest = readMQTTString(rest)
+				b.mutex.Lock()
+				delete(client.subscribed, topic)
+				b.mutex.Unlock()
+			}
+			client.write(0xb0, packetId)
+		case 12: // PINGREQ
+			client.write(0xd0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *mqttTestBroker) forward(topic string, payload []byte) {
+	body := append(mqttString(topic), payload...)
+
+	b.mutex.Lock()
+	var subscribers []*mqttTestClient
+	for client := range b.clients {
+		if client.subscribed[topic] {
+			subscribers = append(subscribers, client)
+		}
+	}
+	b.mutex.Unlock()
+
+	for _, client := range subscribers {
+		client.write(0x30, body)
+	}
+}
+
+func (c *mqttTestClient) write(header byte, body []byte) {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.Write(packet)
+}
+
+func readMQTTPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func readMQTTString(data []byte) (string, []byte) {
+	length := int(binary.BigEndian.Uint16(data))
+	return string(data[2 : 2+length]), data[2+length:]
+}
+
+func mqttString(s string) []byte {
+	data := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(data, uint16(len(s)))
+	return append(data, s...)
+}
+
+func newTestMQTTEventNetwork(t *testing.T, broker *mqttTestBroker, nodeName string, codec Codec) <-chan *Event {
+	t.Helper()
+	network := NewMQTTEventNetworkWithCodec(broker.connexionDetails(), codec)
+	t.Cleanup(func() {
+		network.client.Disconnect(0)
+	})
+	network.SetLogger(newTestLogger())
+	network.SetNodeName(nodeName)
+	events := receiveEvents(network)
+	network.StartListeningForEvents()
+	return events
+}
+
+func TestMQTTEventNetwork(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, CBORCodec} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			testMQTTEventNetwork(t, codec)
+		})
+	}
+}
+
+func testMQTTEventNetwork(t *testing.T, codec Codec) {
+	broker := newMQTTTestBroker(t)
+	aEvents := newTestMQTTEventNetwork(t, broker, "a", codec)
+	bEvents := newTestMQTTEventNetwork(t, broker, "b", JSONCodec)
+
+	// Sending the events through a network of its own, as a third node would
+	network := NewMQTTEventNetworkWithCodec(broker.connexionDetails(), codec)
+	defer network.client.Disconnect(0)
+
+	tests := []struct {
+		name       string
+		event      *Event
+		receiver   string
+		receivedBy []<-chan *Event
+		ignoredBy  []<-chan *Event
+	}{
+		{
+			name:       "broadcast",
+			event:      &Event{Name: "PING", Emitter: "c", Payload: `{"n":1}`},
+			receivedBy: []<-chan *Event{aEvents, bEvents},
+		},
+		{
+			name:       "unicast",
+			event:      &Event{Name: "PING", Emitter: "c", Payload: `{"n":2}`},
+			receiver:   "b",
+			receivedBy: []<-chan *Event{bEvents},
+			ignoredBy:  []<-chan *Event{aEvents},
+		},
+		{
+			name:       "binary",
+			event:      &Event{Name: "IMAGE", Emitter: "c", ContentType: "image/png", Data: []byte{0x89, 'P', 'N', 'G', 0}},
+			receivedBy: []<-chan *Event{aEvents, bEvents},
+		},
+		{
+			name:       "empty binary",
+			event:      &Event{Name: "IMAGE", Emitter: "c", ContentType: "image/png", Data: []byte{}},
+			receivedBy: []<-chan *Event{aEvents, bEvents},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.receiver == "" {
+				network.BroadcastEvent(tt.event)
+			} else {
+				network.SendEventTo(tt.receiver, tt.event)
+			}
+			for i, events := range tt.receivedBy {
+				received := waitForEvent(t, events)
+				if err := compareEvents(received, tt.event); err != nil {
+					t.Errorf("receiver %d: %v", i, err)
+				}
+			}
+			for _, events := range tt.ignoredBy {
+				expectNoEvent(t, events)
+			}
+		})
+	}
+}
+
+func compareEvents(received, sent *Event) error {
+	if received.Name != sent.Name || received.Emitter != sent.Emitter || received.Receiver != sent.Receiver {
+		return fmt.Errorf("received %s from %s to %s, want %s from %s to %s", received.Name, received.Emitter,
+			received.Receiver, sent.Name, sent.Emitter, sent.Receiver)
+	}
+	if received.Payload != sent.Payload || received.ContentType != sent.ContentType {
+		return fmt.Errorf("received payload %q (%s), want %q (%s)", received.Payload, received.ContentType,
+			sent.Payload, sent.ContentType)
+	}
+	if received.IsBinary() != sent.IsBinary() || !bytes.Equal(received.Data, sent.Data) {
+		return fmt.Errorf("received data %v, want %v", received.Data, sent.Data)
+	}
+	return nil
+}
+
+func TestMQTTTopics(t *testing.T) {
+	tests := []struct {
+		receiver string
+		topic    string
+	}{
+		{"*", "events/broadcast"},
+		{"", "events/broadcast"},
+		{"kiosk-1", "events/node/kiosk-1"},
+		{"room/kiosk", "events/node/room_kiosk"},
+		{"kiosk+", "events/node/kiosk_"},
+		{"#", "events/node/_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.receiver, func(t *testing.T) {
+			if topic := mqttTopicFor(tt.receiver); topic != tt.topic {
+				t.Errorf("topic = %s, want %s", topic, tt.topic)
+			}
+		})
+	}
+}
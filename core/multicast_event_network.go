@@ -0,0 +1,328 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/ipv4"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMulticastGroupAddress = "239.255.77.75:7575"
+	DefaultMaxDatagramSize       = 8192
+	DefaultDuplicateWindow       = 10 * time.Second
+
+	multicastFrameVersion    = 1
+	multicastFrameHeaderSize = 16
+
+	// multicastFlagBinary is set when the body is a binary envelope (see encodeBinaryEnvelope)
+	// instead of a JSON encoded event
+	multicastFlagBinary = 0x01
+)
+
+// multicastFrameMagic starts every datagram sent by a MulticastEventNetwork, so that
+// unrelated traffic on the group is ignored.
+var multicastFrameMagic = []byte("DMKT")
+
+// MulticastConfig configures a MulticastEventNetwork.
+// Interface is the name of the network interface to use (e.g. eth0), the system default is used when empty.
+// Redundancy is the number of times each datagram is sent, to make up for packet losses on busy networks.
+// Duplicates (including the ones due to redundancy) are suppressed on reception for DuplicateWindow.
+// Codec is used to encode the sent events, the codec of the received ones being detected from their content.
+type MulticastConfig struct {
+	GroupAddress    string
+	Interface       string
+	MaxDatagramSize int
+	Redundancy      int
+	DuplicateWindow time.Duration
+	Codec           Codec
+}
+
+func DefaultMulticastConfig() MulticastConfig {
+	return MulticastConfig{
+		GroupAddress:    DefaultMulticastGroupAddress,
+		MaxDatagramSize: DefaultMaxDatagramSize,
+		Redundancy:      1,
+		DuplicateWindow: DefaultDuplicateWindow,
+		Codec:           JSONCodec,
+	}
+}
+
+// MulticastEventNetwork is a brokerless EventNetwork using UDP multicast on the local network segment.
+// Each event is sent in a single datagram made of a 16 bytes header followed by the encoded event,
+// or by a binary envelope for events with a binary payload when using the JSONCodec:
+//
+//	| magic "DMKT" (4) | version (1) | flags (1) | message id (8) | body length (2) | body |
+//
+// Unicast events are sent to the whole group and filtered on reception.
+type MulticastEventNetwork struct {
+	config                MulticastConfig
+	groupAddr             *net.UDPAddr
+	iface                 *net.Interface
+	sendConn              *ipv4.PacketConn
+	eventReceivedCallBack EventHandler
+	logger                *log.Entry
+
+	mutex     sync.Mutex
+	nodeName  string
+	listening bool
+	seen      map[uint64]time.Time
+}
+
+func NewMulticastEventNetwork(config MulticastConfig) *MulticastEventNetwork {
+	logger := log.WithField("node", "na-event-network-setup")
+
+	if config.GroupAddress == "" {
+		config.GroupAddress = DefaultMulticastGroupAddress
+	}
+	if config.MaxDatagramSize <= multicastFrameHeaderSize || config.MaxDatagramSize > 65507 {
+		config.MaxDatagramSize = DefaultMaxDatagramSize
+	}
+	if config.Redundancy < 1 {
+		config.Redundancy = 1
+	}
+	if config.DuplicateWindow <= 0 {
+		config.DuplicateWindow = DefaultDuplicateWindow
+	}
+	if config.Codec == nil {
+		config.Codec = JSONCodec
+	}
+
+	groupAddr, err := net.ResolveUDPAddr("udp4", config.GroupAddress)
+	if err != nil {
+		logger.Fatalf("could not resolve multicast group address: %v", err)
+	}
+	if !groupAddr.IP.IsMulticast() {
+		logger.Fatalf("%s is not a multicast address", groupAddr.IP)
+	}
+
+	var iface *net.Interface
+	if config.Interface != "" {
+		iface, err = net.InterfaceByName(config.Interface)
+		if err != nil {
+			logger.Fatalf("could not find network interface %s: %v", config.Interface, err)
+		}
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		logger.Fatalf("could not open the sending socket: %v", err)
+	}
+	sendConn := ipv4.NewPacketConn(conn)
+	if iface != nil {
+		if err := sendConn.SetMulticastInterface(iface); err != nil {
+			logger.Fatalf("could not set the multicast interface: %v", err)
+		}
+	}
+	// Staying on the local segment, and receiving our own events as with the other event networks
+	if err := sendConn.SetMulticastTTL(1); err != nil {
+		logger.Warnf("could not set the multicast TTL: %v", err)
+	}
+	if err := sendConn.SetMulticastLoopback(true); err != nil {
+		logger.Warnf("could not enable multicast loopback: %v", err)
+	}
+
+	return &MulticastEventNetwork{
+		config:    config,
+		groupAddr: groupAddr,
+		iface:     iface,
+		sendConn:  sendConn,
+		logger:    logger.WithField("component", "event-network"),
+		seen:      make(map[uint64]time.Time),
+	}
+}
+
+func (m *MulticastEventNetwork) BroadcastEvent(event *Event) {
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+
+	var flags byte
+	var body []byte
+	var err error
+	if event.IsBinary() && m.config.Codec == JSONCodec {
+		flags |= multicastFlagBinary
+		body, err = encodeBinaryEnvelope(event)
+	} else {
+		body, err = m.config.Codec.Encode(event)
+	}
+	if err != nil {
+		m.logger.Errorf("could not marshal event: %v", err)
+		return
+	}
+
+	frame, err := m.encodeFrame(flags, body)
+	if err != nil {
+		m.logger.Errorf("could not send event %s: %v", event.Name, err)
+		return
+	}
+
+	for i := 0; i < m.config.Redundancy; i++ {
+		if _, err := m.sendConn.WriteTo(frame, nil, m.groupAddr); err != nil {
+			m.logger.Errorf("could not send event: %v", err)
+			return
+		}
+	}
+}
+
+func (m *MulticastEventNetwork) SendEventTo(receiver string, event *Event) {
+	event.Receiver = receiver
+	m.BroadcastEvent(event)
+}
+
+func (m *MulticastEventNetwork) SetReceivedEventCallback(handler EventHandler) {
+	m.eventReceivedCallBack = handler
+}
+
+func (m *MulticastEventNetwork) SetNodeName(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nodeName = name
+}
+
+func (m *MulticastEventNetwork) StartListeningForEvents() {
+	m.mutex.Lock()
+	if m.listening {
+		m.mutex.Unlock()
+		return
+	}
+	m.listening = true
+	m.mutex.Unlock()
+
+	conn, err := net.ListenMulticastUDP("udp4", m.iface, m.groupAddr)
+	if err != nil {
+		m.logger.Fatalf("could not join multicast group %s: %v", m.groupAddr, err)
+	}
+	if err := conn.SetReadBuffer(m.config.MaxDatagramSize * 64); err != nil {
+		m.logger.Warnf("could not set the read buffer size: %v", err)
+	}
+
+	go func() {
+		buffer := make([]byte, m.config.MaxDatagramSize)
+		for {
+			n, src, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				m.logger.Errorf("could not read from multicast group, stopping: %v", err)
+				return
+			}
+
+			event, err := m.decodeFrame(buffer[:n])
+			if err != nil {
+				m.logger.Debugf("ignoring datagram from %s: %v", src, err)
+				continue
+			}
+			if event == nil || !m.isForThisNode(event) {
+				continue
+			}
+
+			if m.eventReceivedCallBack != nil {
+				m.eventReceivedCallBack(event)
+			}
+		}
+	}()
+
+	go m.forgetSeenMessages()
+
+	m.logger.Infof("Listening for events on %s...", m.groupAddr)
+}
+
+func (m *MulticastEventNetwork) SetLogger(logger *log.Entry) {
+	m.logger = logger
+}
+
+func (m *MulticastEventNetwork) encodeFrame(flags byte, body []byte) ([]byte, error) {
+	if len(body) > m.config.MaxDatagramSize-multicastFrameHeaderSize {
+		return nil, fmt.Errorf("event too large: %d bytes, the maximum is %d bytes",
+			len(body), m.config.MaxDatagramSize-multicastFrameHeaderSize)
+	}
+
+	id, err := randomUint64()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate message id: %v", err)
+	}
+
+	frame := make([]byte, multicastFrameHeaderSize, multicastFrameHeaderSize+len(body))
+	copy(frame[0:4], multicastFrameMagic)
+	frame[4] = multicastFrameVersion
+	frame[5] = flags
+	binary.BigEndian.PutUint64(frame[6:14], id)
+	binary.BigEndian.PutUint16(frame[14:16], uint16(len(body)))
+	return append(frame, body...), nil
+}
+
+// decodeFrame returns the event contained in the frame, or nil if the frame is a duplicate.
+func (m *MulticastEventNetwork) decodeFrame(frame []byte) (*Event, error) {
+	if len(frame) < multicastFrameHeaderSize {
+		return nil, fmt.Errorf("frame too short")
+	}
+	if !bytes.Equal(frame[0:4], multicastFrameMagic) {
+		return nil, fmt.Errorf("unknown frame")
+	}
+	if frame[4] != multicastFrameVersion {
+		return nil, fmt.Errorf("unsupported frame version %d", frame[4])
+	}
+
+	id := binary.BigEndian.Uint64(frame[6:14])
+	length := int(binary.BigEndian.Uint16(frame[14:16]))
+	body := frame[multicastFrameHeaderSize:]
+	if len(body) != length {
+		return nil, fmt.Errorf("truncated frame, expected %d bytes, got %d", length, len(body))
+	}
+
+	if m.alreadySeen(id) {
+		return nil, nil
+	}
+
+	if frame[5]&multicastFlagBinary != 0 {
+		return decodeBinaryEnvelope(body)
+	}
+
+	event, err := decodeEvent(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal event: %v", err)
+	}
+	return event, nil
+}
+
+func (m *MulticastEventNetwork) isForThisNode(event *Event) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.nodeName == "" || event.Receiver == "*" || event.Receiver == m.nodeName
+}
+
+func (m *MulticastEventNetwork) alreadySeen(id uint64) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.seen[id]; ok {
+		return true
+	}
+	m.seen[id] = time.Now()
+	return false
+}
+
+func (m *MulticastEventNetwork) forgetSeenMessages() {
+	ticker := time.NewTicker(m.config.DuplicateWindow)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.mutex.Lock()
+		for id, seenAt := range m.seen {
+			if time.Since(seenAt) > m.config.DuplicateWindow {
+				delete(m.seen, id)
+			}
+		}
+		m.mutex.Unlock()
+	}
+}
+
+func randomUint64() (uint64, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestMulticastEventNetwork returns a network encoding and decoding frames, without any socket.
+func newTestMulticastEventNetwork(maxDatagramSize int) *MulticastEventNetwork {
+	config := DefaultMulticastConfig()
+	config.MaxDatagramSize = maxDatagramSize
+	return &MulticastEventNetwork{
+		config: config,
+		logger: newTestLogger(),
+		seen:   make(map[uint64]time.Time),
+	}
+}
+
+func TestMulticastFrames(t *testing.T) {
+	event := Event{Name: "PING", Emitter: "a", Receiver: "*", Payload: `{"n":1}`}
+	body, err := JSONCodec.Encode(&event)
+	if err != nil {
+		t.Fatalf("could not encode the event: %v", err)
+	}
+	binaryEvent := Event{Name: "IMAGE", Emitter: "a", Receiver: "*", ContentType: "image/png", Data: []byte{0, 1, 2}}
+	binaryBody, err := encodeBinaryEnvelope(&binaryEvent)
+	if err != nil {
+		t.Fatalf("could not encode the event: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		maxDatagramSize int
+		flags           byte
+		body            []byte
+		// Changes the encoded frame before it is decoded
+		corrupt func(frame []byte) []byte
+		// Number of times the frame is received, as with Redundancy
+		received int
+		want     *Event
+		// Whether the frame cannot be encoded, or decoded
+		wantEncodeErr bool
+		wantDecodeErr bool
+	}{
+		{name: "round trip", body: body, want: &event},
+		{name: "binary envelope", flags: multicastFlagBinary, body: binaryBody, want: &binaryEvent},
+		{name: "largest event", maxDatagramSize: multicastFrameHeaderSize + len(body), body: body, want: &event},
+		{name: "event too large", maxDatagramSize: multicastFrameHeaderSize + len(body) - 1, body: body,
+			wantEncodeErr: true},
+		{name: "duplicate", body: body, received: 2},
+		{name: "truncated header", body: body, corrupt: func(frame []byte) []byte {
+			return frame[:multicastFrameHeaderSize-1]
+		}, wantDecodeErr: true},
+		{name: "truncated body", body: body, corrupt: func(frame []byte) []byte {
+			return frame[:len(frame)-1]
+		}, wantDecodeErr: true},
+		{name: "unknown magic", body: body, corrupt: func(frame []byte) []byte {
+			frame[0] = 'X'
+			return frame
+		}, wantDecodeErr: true},
+		{name: "unsupported version", body: body, corrupt: func(frame []byte) []byte {
+			frame[4] = multicastFrameVersion + 1
+			return frame
+		}, wantDecodeErr: true},
+		{name: "corrupted body", body: body, corrupt: func(frame []byte) []byte {
+			frame[multicastFrameHeaderSize] = 0xff
+			return frame
+		}, wantDecodeErr: true},
+		{name: "corrupted binary envelope", flags: multicastFlagBinary, body: binaryBody,
+			corrupt: func(frame []byte) []byte {
+				frame[multicastFrameHeaderSize] = 0xff
+				return frame
+			}, wantDecodeErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxDatagramSize := tt.maxDatagramSize
+			if maxDatagramSize == 0 {
+				maxDatagramSize = DefaultMaxDatagramSize
+			}
+			m := newTestMulticastEventNetwork(maxDatagramSize)
+
+			frame, err := m.encodeFrame(tt.flags, tt.body)
+			if (err != nil) != tt.wantEncodeErr {
+				t.Fatalf("encoding error = %v, want error: %v", err, tt.wantEncodeErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.corrupt != nil {
+				frame = tt.corrupt(frame)
+			}
+
+			received := tt.received
+			if received == 0 {
+				received = 1
+			}
+			var decoded *Event
+			for i := 0; i < received; i++ {
+				decoded, err = m.decodeFrame(frame)
+			}
+			if (err != nil) != tt.wantDecodeErr {
+				t.Fatalf("decoding error = %v, want error: %v", err, tt.wantDecodeErr)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Errorf("decoded %+v, want %+v", decoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestMulticastAlreadySeen(t *testing.T) {
+	m := newTestMulticastEventNetwork(DefaultMaxDatagramSize)
+	tests := []struct {
+		name string
+		id   uint64
+		seen bool
+	}{
+		{"first message", 1, false},
+		{"another message", 2, false},
+		{"redundant copy", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if seen := m.alreadySeen(tt.id); seen != tt.seen {
+				t.Errorf("already seen = %v, want %v", seen, tt.seen)
+			}
+		})
+	}
+}
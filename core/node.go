@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/SINTEF-Infosec/demokit/hardware"
 	"github.com/SINTEF-Infosec/demokit/media"
@@ -11,21 +13,32 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 const APIAddr = ":8081"
 
+// ReplyEventSuffix is appended to the name of a request to name its reply, see Node.Request
+const ReplyEventSuffix = "_REPLY"
+
+const eventQueueSize = 256
+
 type NodeError string
 
 func (ne *NodeError) Error() string {
-	return fmt.Sprintf("node error: %s", ne)
+	return fmt.Sprintf("node error: %s", string(*ne))
 }
 
+// NodeInfo describes a node to the registration server. PublicKey is the key used to encrypt the events
+// sent to the node, see SetEncryptionKeyPair. Labels can be used in access-control policies, see SetPolicy.
 type NodeInfo struct {
-	Name    string
-	LocalIp string
+	Name      string
+	LocalIp   string
+	PublicKey string   `json:",omitempty"`
+	Labels    []string `json:",omitempty"`
 }
 
 type internalState struct {
@@ -38,14 +51,30 @@ type NodeCapabilities struct {
 }
 
 type NodeStatus struct {
-	IsReady           bool                `json:"is_ready"`
-	Capabilities      NodeCapabilities    `json:"capabilities"`
-	RegisteredActions map[string][]string `json:"registered_actions"`
-	RegisteredUIs     []string            `json:"registered_ui"`
+	IsReady                 bool                                           `json:"is_ready"`
+	Capabilities            NodeCapabilities                               `json:"capabilities"`
+	RegisteredActions       map[string][]string                            `json:"registered_actions"`
+	RegisteredActionDetails map[string][]RegisteredAction                  `json:"registered_action_details"`
+	RegisteredUIs           []string                                       `json:"registered_ui"`
+	NetworkState            ConnectionState                                `json:"network_state,omitempty"`
+	DecodeFailures          map[string]uint64                              `json:"decode_failures"`
+	ActionFailures          map[string]uint64                              `json:"action_failures"`
+	Schedules               []ScheduleInfo                                 `json:"schedules"`
+	StateMachine            *StateMachineStatus                            `json:"state_machine,omitempty"`
+	EventSchemas            map[SchemaDirection]map[string]json.RawMessage `json:"event_schemas"`
 }
 
+// NodeConfig holds the configuration of a Node.
+// RejectInvalidEvents controls whether the received events whose payload does not match the declared schema are
+// rejected, or only flagged with the InvalidPayloadHeader before being handled.
+// RequireSignedEvents controls whether the received events whose signature cannot be verified are rejected, or only
+// flagged with the UnverifiedEventHeader. Signatures are only verified once an emitter is trusted, see TrustEmitter.
+// ReplayWindow is the maximum age of a received signed event, DefaultReplayWindow if not set.
 type NodeConfig struct {
-	ExposeActions bool
+	ExposeActions       bool
+	RejectInvalidEvents bool
+	RequireSignedEvents bool
+	ReplayWindow        time.Duration
 }
 
 // Node is the main component of the demokit. It aims to be a base for your own node and
@@ -55,9 +84,37 @@ type Node struct {
 	Config             NodeConfig
 	State              internalState
 	Logger             *log.Entry
-	actions            map[string]*Action
+	actions            map[string][]*registeredAction
+	patternActions     []*registeredAction
+	complexMatchers    []*complexEventMatcher
+	actionsMutex       sync.RWMutex
+	lastActionId       ActionId
 	registeredUIs      []string
 	entryPoint         *Action
+	events             chan *Event
+	pendingRequests    map[string]*pendingRequest
+	requestsMutex      sync.Mutex
+	decodeFailures     map[string]uint64
+	statsMutex         sync.Mutex
+	schemas            *SchemaRegistry
+	signer             Signer
+	keyRing            *KeyRing
+	replayGuard        *replayGuard
+	encryptionKeyPair  *EncryptionKeyPair
+	publicKeys         *publicKeyCache
+	nodeLabels         *nodeLabelsCache
+	policy             *Policy
+	policyDenials      []PolicyDenial
+	policyMutex        sync.RWMutex
+	ctx                context.Context
+	stop               context.CancelFunc
+	executions         *executions
+	schedules          *schedules
+	scenarioState      *scenarioState
+	stateMachine       *stateMachine
+	stateMachineMutex  sync.Mutex
+	started            chan struct{}
+	startOnce          sync.Once
 	RegistrationServer *RegistrationServer
 	EventNetwork       EventNetwork
 	Router             *gin.Engine
@@ -73,6 +130,7 @@ func NewNode(info NodeInfo,
 	mediaController media.MediaController,
 	hal hardware.Hal) *Node {
 
+	ctx, stop := context.WithCancel(context.Background())
 	node := &Node{
 		Info:   info,
 		Config: config,
@@ -80,8 +138,22 @@ func NewNode(info NodeInfo,
 			IsReady: false,
 		},
 		Logger:             logger,
-		actions:            map[string]*Action{},
+		actions:            map[string][]*registeredAction{},
 		registeredUIs:      make([]string, 0),
+		events:             make(chan *Event, eventQueueSize),
+		pendingRequests:    make(map[string]*pendingRequest),
+		decodeFailures:     make(map[string]uint64),
+		schemas:            NewSchemaRegistry(),
+		keyRing:            NewKeyRing(),
+		replayGuard:        newReplayGuard(config.ReplayWindow),
+		publicKeys:         newPublicKeyCache(),
+		nodeLabels:         newNodeLabelsCache(),
+		ctx:                ctx,
+		stop:               stop,
+		executions:         newExecutions(),
+		schedules:          newSchedules(),
+		scenarioState:      newScenarioState(),
+		started:            make(chan struct{}),
 		RegistrationServer: rs,
 		EventNetwork:       network,
 		Router:             nil,
@@ -133,12 +205,21 @@ func NewNode(info NodeInfo,
 	}
 
 	// Bindings
+	if nodeAwareNetwork, ok := node.EventNetwork.(NodeAwareEventNetwork); ok {
+		nodeAwareNetwork.SetNodeName(node.Info.Name)
+	}
+
 	node.Logger.Debug("Setting up event callback")
 	node.EventNetwork.SetReceivedEventCallback(node.handleEvent)
+	go node.dispatchEvents()
 
 	// Router configuration
 	node.Logger.Debug("Enabling status")
 	node.ServeStatus()
+	node.ServePolicy()
+	node.ServeExecutions()
+	node.ServeSchedules()
+	node.ServeScenarioState()
 
 	return node
 }
@@ -163,11 +244,21 @@ func (n *Node) Start() {
 	n.EventNetwork.StartListeningForEvents()
 
 	n.Register()
+	if n.policy != nil && n.RegistrationServer != nil {
+		// Getting the labels of the nodes registered before this one
+		if err := n.RefreshNodeLabels(); err != nil {
+			n.Logger.Warnf("could not refresh nodes info: %v", err)
+		}
+	}
 
 	n.Logger.Info("Node ready!")
 	n.State.IsReady = true
+	n.startOnce.Do(func() {
+		close(n.started)
+	})
 
 	go func() {
+		n.enterInitialState()
 		if n.entryPoint != nil {
 			n.ExecuteAction(n.entryPoint, nil)
 		}
@@ -191,6 +282,8 @@ func (n *Node) WaitForExit() {
 	}()
 
 	<-done
+	// Cancelling the running actions
+	n.stop()
 }
 
 func (n *Node) StartAPIServer() {
@@ -203,17 +296,114 @@ func (n *Node) StartAPIServer() {
 }
 
 // OnEventDo is used to register an action to execute when a given event is received.
-func (n *Node) OnEventDo(eventName string, action *Action) {
-	_, ok := n.actions[eventName]
-	if ok {
-		n.Logger.Warnf("an action was already registered for the event %s, ignoring new assignation", eventName)
+// Several actions can be registered for the same event, they are executed by decreasing priority (see
+// OnEventDoWithPriority), then in registration order. The returned id can be used to unregister the action with
+// RemoveAction.
+func (n *Node) OnEventDo(eventName string, action *Action) ActionId {
+	return n.OnEventDoWithPriority(eventName, 0, action)
+}
+
+// OnEventDoWithPriority is similar to OnEventDo, the actions with the highest priority being executed first.
+// Actions with the same priority are executed in registration order.
+func (n *Node) OnEventDoWithPriority(eventName string, priority int, action *Action) ActionId {
+	n.actionsMutex.Lock()
+	n.lastActionId++
+	id := n.lastActionId
+	_, subscribed := n.actions[eventName]
+	// Copying the actions, the dispatcher may be iterating over them
+	actions := append([]*registeredAction{}, n.actions[eventName]...)
+	actions = append(actions, n.newRegisteredAction(id, priority, action, nil))
+	sortRegisteredActions(actions)
+	n.actions[eventName] = actions
+	n.actionsMutex.Unlock()
+
+	if subscribingNetwork, ok := n.EventNetwork.(SubscribingEventNetwork); ok && !subscribed {
+		subscribingNetwork.Subscribe(eventName)
+	}
+	n.Logger.Infof("action configured: %s -> %s (id: %d, priority: %d)", eventName, action.Name, id, priority)
+	return id
+}
+
+// RemoveAction unregisters the action with the given id. It returns false if no such action is registered.
+// The event network stops delivering the events no other action is registered for.
+func (n *Node) RemoveAction(id ActionId) bool {
+	n.actionsMutex.Lock()
+	defer n.actionsMutex.Unlock()
+
+	for eventName, actions := range n.actions {
+		for i, registered := range actions {
+			if registered.id != id {
+				continue
+			}
+			remaining := append(actions[:i:i], actions[i+1:]...)
+			if len(remaining) == 0 {
+				delete(n.actions, eventName)
+				n.unsubscribeUnused(eventName)
+			} else {
+				n.actions[eventName] = remaining
+			}
+			n.Logger.Infof("action removed: %s -> %s (id: %d)", eventName, registered.action.Name, id)
+			return true
+		}
+	}
+
+	for i, registered := range n.patternActions {
+		if registered.id == id {
+			n.patternActions = append(n.patternActions[:i:i], n.patternActions[i+1:]...)
+			if len(n.patternActions) == 0 {
+				n.unsubscribeUnused(AllEvents)
+			}
+			n.Logger.Infof("action removed: %s -> %s (id: %d)", registered.matcher.pattern, registered.action.Name, id)
+			return true
+		}
+	}
+
+	for i, matcher := range n.complexMatchers {
+		if matcher.registered.id == id {
+			n.complexMatchers = append(n.complexMatchers[:i:i], n.complexMatchers[i+1:]...)
+			n.unsubscribeUnused(matcher.pattern.Events...)
+			n.Logger.Infof("action removed: %s -> %s (id: %d)", matcher.pattern, matcher.registered.action.Name, id)
+			return true
+		}
+	}
+	return false
+}
+
+// unsubscribeUnused unsubscribes from the given events if no action is registered for them anymore.
+// It must be called with the actions mutex held, so that the subscriptions of the actions being registered are not
+// undone.
+func (n *Node) unsubscribeUnused(eventNames ...string) {
+	subscribingNetwork, ok := n.EventNetwork.(SubscribingEventNetwork)
+	if !ok {
 		return
 	}
+	for _, eventName := range eventNames {
+		if n.isSubscribed(eventName) {
+			continue
+		}
+		subscribingNetwork.Unsubscribe(eventName)
+	}
+}
 
-	n.actions[eventName] = action
-	n.Logger.Infof("action configured: %s -> %s", eventName, action.Name)
+// isSubscribed returns whether an action needs the given event. It must be called with the actions mutex held.
+func (n *Node) isSubscribed(eventName string) bool {
+	if eventName == AllEvents {
+		return len(n.patternActions) > 0
+	}
+	if _, ok := n.actions[eventName]; ok {
+		return true
+	}
+	for _, matcher := range n.complexMatchers {
+		if containsString(matcher.pattern.Events, eventName) {
+			return true
+		}
+	}
+	return false
 }
 
+// handleEvent is called by the event network for each received event.
+// Replies to pending requests are handled right away, the other events are queued and their actions are
+// executed in order by dispatchEvents, so that the event network is never blocked by an action.
 func (n *Node) handleEvent(event *Event) {
 	// Ignoring events sent by this node
 	if event.Emitter == n.Info.Name {
@@ -225,58 +415,381 @@ func (n *Node) handleEvent(event *Event) {
 		return
 	}
 
-	action, ok := n.actions[event.Name]
-	if !ok {
-		n.Logger.Debugf("no actions registered for event %s, ignoring", event.Name)
+	event.receivedAt = time.Now()
+	event.normalize()
+	n.Logger.Debugf("received event %s (id: %s, version: %d) from %s", event.Name, event.Id, event.Version, event.Emitter)
+
+	if n.Config.RequireSignedEvents || !n.keyRing.IsEmpty() {
+		if err := n.authenticateEvent(event); err != nil {
+			if n.Config.RequireSignedEvents {
+				n.Logger.Warnf("rejecting event %s from %s: %v", event.Name, event.Emitter, err)
+				return
+			}
+			n.Logger.Warnf("event %s from %s flagged as unverified: %v", event.Name, event.Emitter, err)
+			event.SetHeader(UnverifiedEventHeader, err.Error())
+		}
+	}
+
+	if err := n.checkPolicy(event, false); err != nil {
 		return
 	}
 
-	n.ExecuteAction(action, event)
+	// Decrypting once the signature of the encrypted payload is verified
+	if event.IsEncrypted() {
+		if err := n.decryptEvent(event); err != nil {
+			n.Logger.Warnf("rejecting encrypted event %s from %s: %v", event.Name, event.Emitter, err)
+			return
+		}
+	}
+
+	n.deliverEvent(event)
+}
+
+// handleLocalEvent is used by the components of the node (hardware layer, media controller...) to trigger actions.
+// Unlike the events received from the network, these events are trusted.
+func (n *Node) handleLocalEvent(event *Event) {
+	event.receivedAt = time.Now()
+	event.normalize()
+	n.Logger.Debugf("local event %s from %s", event.Name, event.Emitter)
+	n.deliverEvent(event)
 }
 
+// deliverEvent validates the payload of an accepted event, before resolving the request it answers or queuing it.
+func (n *Node) deliverEvent(event *Event) {
+	if err := n.schemas.Validate(SchemaConsumed, event); err != nil {
+		if n.Config.RejectInvalidEvents {
+			n.Logger.Warnf("rejecting event from %s: %v", event.Emitter, err)
+			return
+		}
+		n.Logger.Warnf("event from %s flagged as invalid: %v", event.Emitter, err)
+		event.SetHeader(InvalidPayloadHeader, err.Error())
+	}
+
+	if event.CorrelationId != "" && strings.HasSuffix(event.Name, ReplyEventSuffix) {
+		if n.resolveRequest(event) {
+			return
+		}
+		n.Logger.Debugf("no pending request for %s (%s), it may have timed out", event.Name, event.CorrelationId)
+	}
+
+	n.events <- event
+}
+
+func (n *Node) dispatchEvents() {
+	for event := range n.events {
+		n.dispatchEvent(event)
+	}
+}
+
+func (n *Node) dispatchEvent(event *Event) {
+	actions := n.actionsFor(event)
+	if len(actions) == 0 {
+		n.Logger.Debugf("no actions registered for event %s", event.Name)
+	}
+
+	for _, registered := range actions {
+		registered.scheduler.trigger(event)
+	}
+	n.processComplexEvents(event)
+}
+
+// ExecuteAction executes the action chain. The execution can be cancelled with CancelExecution, and is cancelled
+// when the node stops, see ContextEventHandler. Failures that are not handled by an OnError branch are logged
+// and reported by the node API.
 func (n *Node) ExecuteAction(action *Action, event *Event) {
 	if action == nil {
 		return
 	}
 
+	ctx, id := n.executions.start(n.ctx, action, event)
+	defer n.executions.end(id)
+	if err := n.executeAction(ctx, action, event); err != nil && ctx.Err() == nil {
+		n.Logger.Errorf("execution %d of %s failed: %v", id, action.Name, err)
+		n.executions.fail(id, err)
+	}
+}
+
+// executeAction executes the action chain, and returns the error of the failing action unless handled by
+// an OnError branch. Cancelled executions are not failures.
+func (n *Node) executeAction(ctx context.Context, action *Action, event *Event) error {
+	if action == nil || ctx.Err() != nil {
+		return nil
+	}
+
 	n.Logger.Debugf("Start executing %s", action.Name)
-	if action.Do == nil {
-		return
+	if !action.hasBody() {
+		return nil
+	}
+
+	if action.DoDelay > 0 && !sleepContext(ctx, time.Duration(action.DoDelay)*time.Millisecond) {
+		n.Logger.Debugf("execution of %s cancelled", action.Name)
+		return nil
+	}
+
+	var err error
+	if action.Repeat == nil {
+		err = n.executeActionBody(ctx, action, event)
+	} else {
+		for i := 1; ctx.Err() == nil; i++ {
+			if err = n.executeActionBody(ctx, action, event); err != nil {
+				break
+			}
+			if action.Repeat.Count > 0 && i >= action.Repeat.Count {
+				break
+			}
+			if action.Repeat.Until != nil && action.Repeat.Until(event) {
+				break
+			}
+			if action.Repeat.Every > 0 && !sleepContext(ctx, time.Duration(action.Repeat.Every)*time.Millisecond) {
+				break
+			}
+		}
 	}
 
-	if action.DoDelay > 0 {
-		time.Sleep(time.Duration(action.DoDelay) * time.Millisecond)
+	if ctx.Err() != nil {
+		n.Logger.Debugf("execution of %s cancelled", action.Name)
+		return nil
 	}
 
-	if action.DoCondition != nil {
-		if action.DoCondition(event) {
-			action.Do(event)
+	if err != nil {
+		if action.OnError == nil {
+			return err
 		}
+		n.Logger.Warnf("%v, executing %s", err, action.OnError.Name)
+		return n.executeAction(context.WithValue(ctx, actionErrorKey{}, err), action.OnError, event)
+	}
+	return n.executeAction(ctx, action.Then, event)
+}
+
+// executeActionBody executes Do or Else depending on the condition of the action, then its Parallel actions.
+// It returns the first error of the Do handler, of the Else branch or of the Parallel actions.
+func (n *Node) executeActionBody(ctx context.Context, action *Action, event *Event) error {
+	if action.DoCondition == nil || action.DoCondition(event) {
+		if err := n.runHandler(ctx, action, event); err != nil {
+			return err
+		}
+	} else if err := n.executeAction(ctx, action.Else, event); err != nil {
+		return err
+	}
+
+	if len(action.Parallel) == 0 {
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(action.Parallel))
+	for i, parallel := range action.Parallel {
+		wg.Add(1)
+		go func(i int, parallel *Action) {
+			defer wg.Done()
+			errs[i] = n.executeAction(ctx, parallel, event)
+		}(i, parallel)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BroadcastEvent sends an event to all the nodes. An error is returned if the event cannot be sent,
+// e.g. if its payload does not match the schema declared with DeclareEventSchema.
+func (n *Node) BroadcastEvent(eventName, payload string) error {
+	return n.EmitEvent(&Event{
+		Name:     eventName,
+		Receiver: "*",
+		Payload:  payload,
+	})
+}
+
+// SendEventTo sends an event to the receiver. See BroadcastEvent for the returned errors.
+func (n *Node) SendEventTo(receiver string, eventName, payload string) error {
+	return n.EmitEvent(&Event{
+		Name:     eventName,
+		Receiver: receiver,
+		Payload:  payload,
+	})
+}
+
+// EmitEvent completes the envelope of the event (emitter, id, timestamp and version) and sends it,
+// to its receiver if set, to all the nodes otherwise. It allows to emit events with headers or a cause.
+// The event is signed if a signer is set, see SetSigner.
+func (n *Node) EmitEvent(event *Event) error {
+	n.prepareEvent(event)
+
+	if err := n.checkPolicy(event, true); err != nil {
+		n.Logger.Errorf("not sending event: %v", err)
+		return err
+	}
+	return n.sendEvent(event)
+}
+
+// sendEvent validates, signs and sends an event allowed by the policy.
+func (n *Node) sendEvent(event *Event) error {
+	// The payload of encrypted events is validated before their encryption
+	if !event.IsEncrypted() {
+		if err := n.schemas.Validate(SchemaEmitted, event); err != nil {
+			n.Logger.Errorf("not sending event: %v", err)
+			return err
+		}
+	}
+
+	if n.signer != nil {
+		if err := signEvent(n.signer, event); err != nil {
+			n.Logger.Errorf("not sending event %s: %v", event.Name, err)
+			return err
+		}
+	}
+
+	if event.Receiver == "" || event.Receiver == "*" {
+		n.EventNetwork.BroadcastEvent(event)
 	} else {
-		action.Do(event)
+		n.EventNetwork.SendEventTo(event.Receiver, event)
+	}
+	return nil
+}
+
+// DeclareEventSchema declares the JSON Schema of the payload of an event emitted or consumed by this node.
+// Emitted events that do not match their schema are not sent, and consumed ones are rejected or flagged
+// depending on NodeConfig.RejectInvalidEvents.
+func (n *Node) DeclareEventSchema(direction SchemaDirection, eventName, schema string) error {
+	if err := n.schemas.Register(direction, eventName, schema); err != nil {
+		return err
+	}
+	n.Logger.Infof("schema declared for %s event %s", direction, eventName)
+	return nil
+}
+
+// SetSigner sets the signer of the events emitted by this node. A nil signer disables signing.
+func (n *Node) SetSigner(signer Signer) {
+	n.signer = signer
+}
+
+// TrustEmitter registers the verifier of the signatures of the events emitted by emitter, "*" standing for all
+// the emitters without a verifier of their own. Once an emitter is trusted, the signature of all the received events
+// is verified, the unsigned ones being flagged or rejected (see NodeConfig.RequireSignedEvents).
+func (n *Node) TrustEmitter(emitter string, verifier Verifier) {
+	n.keyRing.Trust(emitter, verifier)
+	n.Logger.Infof("trusting %s signatures of %s", verifier.Algorithm(), emitter)
+}
+
+// authenticateEvent verifies the signature of the event, and makes sure it is not replayed.
+func (n *Node) authenticateEvent(event *Event) error {
+	if err := verifyEvent(n.keyRing, event); err != nil {
+		return err
 	}
+	return n.replayGuard.check(event)
+}
 
-	if action.Then != nil {
-		n.ExecuteAction(action.Then, event)
+func (n *Node) prepareEvent(event *Event) {
+	event.Emitter = n.Info.Name
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+	event.Version = EventVersion
+	if event.Id == "" {
+		id, err := newEventId()
+		if err != nil {
+			n.Logger.Errorf("could not generate event id: %v", err)
+		}
+		event.Id = id
 	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+}
+
+// pendingRequest is a request sent with Request, waiting for the reply of its receiver.
+type pendingRequest struct {
+	receiver string
+	replies  chan *Event
 }
 
-func (n *Node) BroadcastEvent(eventName, payload string) {
-	event := &Event{
-		Name:    eventName,
-		Emitter: n.Info.Name,
-		Payload: payload,
+// Request sends an event to the receiver and waits for its reply, sent with Reply.
+// It returns the payload of the reply, or an error if no reply is received before the timeout. If the request is
+// broadcast ("*" receiver), the first reply is returned, whatever the node that sent it.
+//
+// Request can be called from an Action: replies are handled as soon as they are received, without waiting for
+// the current action to end. Unless the action has a Concurrency mode, the other events are however not handled
+// before the end of the action.
+func (n *Node) Request(receiver, eventName, payload string, timeout time.Duration) (string, error) {
+	correlationId, err := newEventId()
+	if err != nil {
+		return "", fmt.Errorf("could not generate correlation id: %v", err)
+	}
+
+	replies := make(chan *Event, 1)
+	n.requestsMutex.Lock()
+	n.pendingRequests[correlationId] = &pendingRequest{receiver: receiver, replies: replies}
+	n.requestsMutex.Unlock()
+
+	defer func() {
+		n.requestsMutex.Lock()
+		delete(n.pendingRequests, correlationId)
+		n.requestsMutex.Unlock()
+	}()
+
+	err = n.EmitEvent(&Event{
+		Name:          eventName,
+		Receiver:      receiver,
+		Payload:       payload,
+		CorrelationId: correlationId,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-replies:
+		return reply.Payload, nil
+	case <-timer.C:
+		return "", fmt.Errorf("no reply from %s to %s after %s", receiver, eventName, timeout)
 	}
-	n.EventNetwork.BroadcastEvent(event)
 }
 
-func (n *Node) SendEventTo(receiver string, eventName, payload string) {
-	event := &Event{
-		Name:    eventName,
-		Emitter: n.Info.Name,
-		Payload: payload,
+// Reply answers to a request sent by another node with Request. It is meant to be called by the Action
+// triggered by the request, with the event given to the action.
+func (n *Node) Reply(request *Event, payload string) error {
+	if request == nil || request.CorrelationId == "" {
+		return fmt.Errorf("cannot reply, the event is not a request")
 	}
-	n.EventNetwork.SendEventTo(receiver, event)
+
+	return n.EmitEvent(&Event{
+		Name:          request.Name + ReplyEventSuffix,
+		Receiver:      request.Emitter,
+		Payload:       payload,
+		CorrelationId: request.CorrelationId,
+		CausationId:   request.Id,
+	})
+}
+
+// resolveRequest delivers a reply to the pending request it answers, if any. Replies sent by another node than the
+// receiver of the request are ignored. It returns false if no request is pending.
+func (n *Node) resolveRequest(reply *Event) bool {
+	n.requestsMutex.Lock()
+	defer n.requestsMutex.Unlock()
+
+	request, ok := n.pendingRequests[reply.CorrelationId]
+	if !ok {
+		return false
+	}
+	if request.receiver != "*" && reply.Emitter != request.receiver {
+		n.Logger.Warnf("ignoring reply %s to request %s from %s, expected from %s", reply.Name, reply.CorrelationId,
+			reply.Emitter, request.receiver)
+		return true
+	}
+
+	select {
+	case request.replies <- reply:
+	default:
+		n.Logger.Debugf("request %s already answered, ignoring reply", reply.CorrelationId)
+	}
+	return true
 }
 
 func (n *Node) RegisterUI(endpoint string) {
@@ -293,8 +806,10 @@ func (n *Node) RegisterUI(endpoint string) {
 func (n *Node) ServeStatus() {
 	n.Router.GET("/status", func(c *gin.Context) {
 		var actions map[string][]string
+		var details map[string][]RegisteredAction
 		if n.Config.ExposeActions {
-			actions = n.getRegisteredActions()
+			details = n.getRegisteredActions()
+			actions = getActionNames(details)
 		}
 		ns := NodeStatus{
 			IsReady: n.State.IsReady,
@@ -302,24 +817,78 @@ func (n *Node) ServeStatus() {
 				HardwareAvailable: n.Hardware.IsAvailable(),
 				MediaAvailable:    n.MediaController.IsAvailable(),
 			},
-			RegisteredActions: actions,
-			RegisteredUIs:     n.registeredUIs,
+			RegisteredActions:       actions,
+			RegisteredActionDetails: details,
+			RegisteredUIs:           n.registeredUIs,
+			DecodeFailures:          n.getDecodeFailures(),
+			ActionFailures:          n.executions.failuresByAction(),
+			Schedules:               n.Schedules(),
+			StateMachine:            n.getStateMachineStatus(),
+			EventSchemas:            n.schemas.Schemas(),
+		}
+		if reporter, ok := n.EventNetwork.(ConnectionStateReporter); ok {
+			ns.NetworkState = reporter.ConnectionState()
 		}
 		c.JSON(http.StatusOK, ns)
 	})
 }
 
-func (n *Node) getRegisteredActions() map[string][]string {
-	regActions := make(map[string][]string, len(n.actions))
-	for event, action := range n.actions {
-		regActions[event] = getActionsList(action, []string{})
+func (n *Node) getRegisteredActions() map[string][]RegisteredAction {
+	n.actionsMutex.RLock()
+	defer n.actionsMutex.RUnlock()
+	regActions := make(map[string][]RegisteredAction, len(n.actions))
+	for event, actions := range n.actions {
+		for _, registered := range actions {
+			regActions[event] = append(regActions[event], RegisteredAction{
+				Id:          registered.id,
+				Priority:    registered.priority,
+				Concurrency: registered.scheduler.mode,
+				Actions:     getActionsList(registered.action, []string{}),
+			})
+		}
+	}
+	for _, registered := range n.patternActions {
+		pattern := registered.matcher.pattern.String()
+		regActions[pattern] = append(regActions[pattern], RegisteredAction{
+			Id:          registered.id,
+			Priority:    registered.priority,
+			Pattern:     true,
+			Concurrency: registered.scheduler.mode,
+			Actions:     getActionsList(registered.action, []string{}),
+		})
+	}
+	for _, matcher := range n.complexMatchers {
+		pattern := matcher.pattern.String()
+		regActions[pattern] = append(regActions[pattern], RegisteredAction{
+			Id:          matcher.registered.id,
+			Pattern:     true,
+			Concurrency: matcher.registered.scheduler.mode,
+			Actions:     getActionsList(matcher.registered.action, []string{}),
+		})
 	}
 	return regActions
 }
 
+// getActionNames lists the names of the actions registered for each event, as in the registered_actions field of
+// the status.
+func getActionNames(details map[string][]RegisteredAction) map[string][]string {
+	names := make(map[string][]string, len(details))
+	for event, actions := range details {
+		names[event] = []string{}
+		for _, registered := range actions {
+			names[event] = append(names[event], registered.Actions...)
+		}
+	}
+	return names
+}
+
 func getActionsList(action *Action, acc []string) []string {
 	if action != nil {
 		acc = append(acc, action.Name)
+		acc = getActionsList(action.Else, acc)
+		for _, parallel := range action.Parallel {
+			acc = getActionsList(parallel, acc)
+		}
 		acc = getActionsList(action.Then, acc)
 	}
 	return acc
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testTimeout = 2 * time.Second
+
+// newTestNode returns a node attached to the bus, with a silent logger.
+func newTestNode(t *testing.T, name string, bus *InMemoryEventBus) *Node {
+	t.Helper()
+	network := NewInMemoryEventNetwork(bus)
+	t.Cleanup(network.Close)
+	return newTestNodeWithNetwork(t, name, network)
+}
+
+func newTestNodeWithNetwork(t *testing.T, name string, network EventNetwork) *Node {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	n := NewNode(NodeInfo{Name: name}, NodeConfig{}, newTestLogger(), nil, network, nil, nil)
+	t.Cleanup(n.stop)
+	return n
+}
+
+func newTestLogger() *log.Entry {
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	return log.NewEntry(logger)
+}
+
+// startTestNode starts listening for events, as Start does, without the API server, the registration and the
+// wait for a signal.
+func startTestNode(n *Node) {
+	n.EventNetwork.StartListeningForEvents()
+	n.State.IsReady = true
+	n.startOnce.Do(func() {
+		close(n.started)
+	})
+}
+
+// receiveEvents makes the network deliver its events to the returned channel.
+func receiveEvents(network EventNetwork) <-chan *Event {
+	events := make(chan *Event, 64)
+	network.SetReceivedEventCallback(func(event *Event) {
+		events <- event
+	})
+	return events
+}
+
+func waitForEvent(t *testing.T, events <-chan *Event) *Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(testTimeout):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func expectNoEvent(t *testing.T, events <-chan *Event) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s", event.Name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNodeDispatchesReceivedEvents(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	emitter := newTestNode(t, "emitter", bus)
+	receiver := newTestNode(t, "receiver", bus)
+	other := newTestNode(t, "other", bus)
+
+	handled := make(chan *Event, 8)
+	handler := &Action{Name: "record", Do: func(event *Event) { handled <- event }}
+	for _, n := range []*Node{emitter, receiver, other} {
+		n.OnEventDo("PING", handler)
+		startTestNode(n)
+	}
+
+	tests := []struct {
+		name     string
+		send     func() error
+		expected int
+	}{
+		{"broadcast", func() error { return emitter.BroadcastEvent("PING", "") }, 2},
+		{"unicast", func() error { return emitter.SendEventTo("receiver", "PING", "") }, 1},
+		{"unknown receiver", func() error { return emitter.SendEventTo("nobody", "PING", "") }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatalf("could not send the event: %v", err)
+			}
+			for i := 0; i < tt.expected; i++ {
+				event := waitForEvent(t, handled)
+				if event.Emitter != "emitter" {
+					t.Errorf("emitter = %s, want emitter", event.Emitter)
+				}
+			}
+			expectNoEvent(t, handled)
+		})
+	}
+}
+
+func TestNodeHandlesEventsInOrder(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	emitter := newTestNode(t, "emitter", bus)
+	receiver := newTestNode(t, "receiver", bus)
+
+	const count = 200
+	handled := make(chan *Event, count)
+	receiver.OnEventDo("PING", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	receiver.OnEventDo("PONG", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	startTestNode(emitter)
+	startTestNode(receiver)
+
+	for i := 0; i < count; i++ {
+		name := "PING"
+		if i%2 == 1 {
+			name = "PONG"
+		}
+		if err := emitter.SendEventTo("receiver", name, strconv.Itoa(i)); err != nil {
+			t.Fatalf("could not send the event: %v", err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		if event := waitForEvent(t, handled); event.Payload != strconv.Itoa(i) {
+			t.Fatalf("event %s handled in position %d", event.Payload, i)
+		}
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	requester := newTestNode(t, "requester", bus)
+	responder := newTestNode(t, "responder", bus)
+	impostor := newTestNode(t, "impostor", bus)
+
+	responder.OnEventDo("ASK", &Action{Name: "reply", Do: func(event *Event) {
+		_ = responder.Reply(event, "answer to "+event.Payload)
+	}})
+	// Answering in place of the responder
+	responder.OnEventDo("ASK_IMPOSTOR", &Action{Name: "reply", Do: func(event *Event) {
+		_ = impostor.Reply(event, "fake answer")
+	}})
+	for _, n := range []*Node{requester, responder, impostor} {
+		startTestNode(n)
+	}
+
+	tests := []struct {
+		name     string
+		receiver string
+		event    string
+		reply    string
+		wantErr  bool
+	}{
+		{"reply", "responder", "ASK", "answer to question", false},
+		{"broadcast request", "*", "ASK", "answer to question", false},
+		{"no reply", "nobody", "ASK", "", true},
+		{"reply from another node", "responder", "ASK_IMPOSTOR", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := requester.Request(tt.receiver, tt.event, "question", 100*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+		})
+	}
+
+	requester.requestsMutex.Lock()
+	defer requester.requestsMutex.Unlock()
+	if len(requester.pendingRequests) != 0 {
+		t.Errorf("%d requests still pending", len(requester.pendingRequests))
+	}
+}
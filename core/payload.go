@@ -0,0 +1,125 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var eventPointerType = reflect.TypeOf(&Event{})
+
+// DecodePayload decodes the JSON payload of the event into v. The event is nil for the actions executed as entry
+// point or on a schedule, an error is returned in that case.
+func (e *Event) DecodePayload(v interface{}) error {
+	if e == nil {
+		return fmt.Errorf("no event to decode the payload of")
+	}
+	payload := []byte(e.Payload)
+	if e.IsBinary() {
+		if e.PayloadContentType() != ContentTypeJSON {
+			return fmt.Errorf("cannot decode %s payload of %s as JSON", e.PayloadContentType(), e.Name)
+		}
+		payload = e.Data
+	}
+
+	if len(payload) == 0 {
+		return fmt.Errorf("empty payload")
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("could not decode payload of %s: %v", e.Name, err)
+	}
+	return nil
+}
+
+// BroadcastJSON broadcasts an event whose payload is the JSON encoding of v.
+func (n *Node) BroadcastJSON(eventName string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode payload of %s: %v", eventName, err)
+	}
+	return n.BroadcastEvent(eventName, string(payload))
+}
+
+// SendJSONTo sends an event whose payload is the JSON encoding of v to the receiver.
+func (n *Node) SendJSONTo(receiver string, eventName string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode payload of %s: %v", eventName, err)
+	}
+	return n.SendEventTo(receiver, eventName, string(payload))
+}
+
+// NewPayloadHandler returns an EventHandler decoding the JSON payload of the received events before calling handler.
+// handler must be a function of the form func(event *Event, payload T), where T is the type the payload is decoded
+// into (struct, pointer to a struct, map, slice...). If the payload cannot be decoded, the failure is logged and
+// counted, and handler is not called.
+func (n *Node) NewPayloadHandler(handler interface{}) (EventHandler, error) {
+	handlerValue := reflect.ValueOf(handler)
+	if !handlerValue.IsValid() {
+		return nil, fmt.Errorf("invalid payload handler: nil")
+	}
+	handlerType := handlerValue.Type()
+	if handlerType.Kind() != reflect.Func || handlerType.NumIn() != 2 || handlerType.NumOut() != 0 ||
+		handlerType.In(0) != eventPointerType {
+		return nil, fmt.Errorf("invalid payload handler %s, expected func(*core.Event, T)", handlerType)
+	}
+	if handlerValue.IsNil() {
+		return nil, fmt.Errorf("invalid payload handler: nil %s", handlerType)
+	}
+
+	payloadType := handlerType.In(1)
+	return func(event *Event) {
+		if event == nil {
+			n.Logger.Errorf("could not decode payload into %s: no event", payloadType)
+			return
+		}
+
+		// Decoding into a pointer, whatever the expected type is
+		target := payloadType
+		if payloadType.Kind() == reflect.Ptr {
+			target = payloadType.Elem()
+		}
+		payload := reflect.New(target)
+
+		if err := event.DecodePayload(payload.Interface()); err != nil {
+			n.countDecodeFailure(event.Name)
+			n.Logger.Errorf("could not decode payload of %s from %s into %s: %v", event.Name, event.Emitter, payloadType, err)
+			return
+		}
+
+		if payloadType.Kind() != reflect.Ptr {
+			payload = payload.Elem()
+		}
+		handlerValue.Call([]reflect.Value{reflect.ValueOf(event), payload})
+	}, nil
+}
+
+// OnEventDoWithPayload is similar to OnEventDo, for an action whose handler receives the decoded payload of the event.
+// See NewPayloadHandler for the expected form of handler.
+func (n *Node) OnEventDoWithPayload(eventName, actionName string, handler interface{}) error {
+	eventHandler, err := n.NewPayloadHandler(handler)
+	if err != nil {
+		return err
+	}
+	n.OnEventDo(eventName, &Action{
+		Name: actionName,
+		Do:   eventHandler,
+	})
+	return nil
+}
+
+func (n *Node) countDecodeFailure(eventName string) {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	n.decodeFailures[eventName]++
+}
+
+func (n *Node) getDecodeFailures() map[string]uint64 {
+	n.statsMutex.Lock()
+	defer n.statsMutex.Unlock()
+	failures := make(map[string]uint64, len(n.decodeFailures))
+	for eventName, count := range n.decodeFailures {
+		failures[eventName] = count
+	}
+	return failures
+}
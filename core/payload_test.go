@@ -0,0 +1,113 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *Event
+		want    testPayload
+		wantErr bool
+	}{
+		{"text", &Event{Name: "A", Payload: `{"name":"a","count":1}`}, testPayload{"a", 1}, false},
+		{"JSON data", &Event{Name: "A", ContentType: ContentTypeJSON, Data: []byte(`{"count":2}`)}, testPayload{Count: 2},
+			false},
+		{"no event", nil, testPayload{}, true},
+		{"empty payload", &Event{Name: "A"}, testPayload{}, true},
+		{"invalid JSON", &Event{Name: "A", Payload: `{"name":`}, testPayload{}, true},
+		{"wrong type", &Event{Name: "A", Payload: `{"count":"one"}`}, testPayload{}, true},
+		{"binary data", &Event{Name: "A", Data: []byte{0, 1}}, testPayload{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload testPayload
+			err := tt.event.DecodePayload(&payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && payload != tt.want {
+				t.Errorf("payload = %+v, want %+v", payload, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPayloadHandler(t *testing.T) {
+	var nilHandler func(*Event, testPayload)
+	tests := []struct {
+		name    string
+		handler interface{}
+	}{
+		{"nil", nil},
+		{"nil function", nilHandler},
+		{"not a function", testPayload{}},
+		{"no payload", func(_ *Event) {}},
+		{"no event", func(_ string, _ testPayload) {}},
+		{"returning a value", func(_ *Event, _ testPayload) error { return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNode(t, "node", NewInMemoryEventBus())
+			if _, err := n.NewPayloadHandler(tt.handler); err == nil {
+				t.Error("the handler is accepted")
+			}
+		})
+	}
+}
+
+func TestPayloadHandlerDecoding(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	var received []testPayload
+	byValue, err := n.NewPayloadHandler(func(_ *Event, payload testPayload) {
+		received = append(received, payload)
+	})
+	if err != nil {
+		t.Fatalf("could not create the handler: %v", err)
+	}
+	byPointer, err := n.NewPayloadHandler(func(_ *Event, payload *testPayload) {
+		received = append(received, *payload)
+	})
+	if err != nil {
+		t.Fatalf("could not create the handler: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler EventHandler
+		event   *Event
+		// Name decoded from the payload, empty if the handler is not called
+		decoded string
+	}{
+		{"value", byValue, &Event{Name: "A", Payload: `{"name":"a"}`}, "a"},
+		{"pointer", byPointer, &Event{Name: "B", Payload: `{"name":"b"}`}, "b"},
+		{"invalid payload", byValue, &Event{Name: "C", Payload: `[1, 2]`}, ""},
+		{"empty payload", byPointer, &Event{Name: "D"}, ""},
+		{"no event", byValue, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			tt.handler(tt.event)
+			var want []testPayload
+			if tt.decoded != "" {
+				want = []testPayload{{Name: tt.decoded}}
+			}
+			if !reflect.DeepEqual(received, want) {
+				t.Errorf("received %+v, want %+v", received, want)
+			}
+		})
+	}
+
+	want := map[string]uint64{"C": 1, "D": 1}
+	if failures := n.getDecodeFailures(); !reflect.DeepEqual(failures, want) {
+		t.Errorf("decode failures = %v, want %v", failures, want)
+	}
+}
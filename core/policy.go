@@ -0,0 +1,311 @@
+package core
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+const maxPolicyDenials = 100
+
+// nodeLabelsRefreshInterval is the minimum delay between two refreshes of the labels of the other nodes, when
+// unknown nodes are met.
+const nodeLabelsRefreshInterval = 5 * time.Second
+
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// PolicyDirection tells whether a rule applies to the nodes emitting or receiving the events.
+type PolicyDirection string
+
+const (
+	PolicyEmit    PolicyDirection = "emit"
+	PolicyReceive PolicyDirection = "receive"
+)
+
+// PolicyRule allows or denies the nodes matching Nodes or Labels to emit or receive (see Direction, both if empty)
+// the events matching Events. Patterns use the syntax of path.Match, e.g. "I_JOYSTICK_*".
+// Empty Nodes and Labels match all the nodes, and empty Events match all the events.
+type PolicyRule struct {
+	Effect    PolicyEffect    `json:"effect"`
+	Direction PolicyDirection `json:"direction,omitempty"`
+	Nodes     []string        `json:"nodes,omitempty"`
+	Labels    []string        `json:"labels,omitempty"`
+	Events    []string        `json:"events,omitempty"`
+}
+
+// Policy is an ordered list of rules, the first matching rule deciding whether an event is allowed.
+// If no rule matches, Default applies (allow if empty).
+//
+// The labels of the other nodes are the ones they declared to the registration server (see NodeInfo.Labels),
+// fetched again in the background when an unknown node is met: until then, the node is checked without labels.
+// Labels are not authenticated: a node can declare any label, so they
+// only protect against mistakes, not against malicious nodes. The nodes that are not registered have no labels,
+// so the deny rules based on labels do not apply to them: prefer a deny default with allow rules.
+type Policy struct {
+	Default PolicyEffect `json:"default"`
+	Rules   []PolicyRule `json:"rules"`
+}
+
+// PolicyDenial records an event denied by the policy.
+type PolicyDenial struct {
+	Time      time.Time       `json:"time"`
+	Direction PolicyDirection `json:"direction"`
+	Node      string          `json:"node"`
+	EventName string          `json:"event_name"`
+	EventId   string          `json:"event_id"`
+	Emitter   string          `json:"emitter"`
+	Receiver  string          `json:"receiver"`
+	Rule      int             `json:"rule"`
+}
+
+// PolicyStatus is served on /policy.
+type PolicyStatus struct {
+	Policy  *Policy        `json:"policy"`
+	Denials []PolicyDenial `json:"denials"`
+}
+
+// Validate checks the effects, directions and patterns of the policy.
+func (p *Policy) Validate() error {
+	if p.Default != "" && p.Default != PolicyAllow && p.Default != PolicyDeny {
+		return fmt.Errorf("invalid default effect: %s", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Effect != PolicyAllow && rule.Effect != PolicyDeny {
+			return fmt.Errorf("rule %d: invalid effect: %s", i, rule.Effect)
+		}
+		if rule.Direction != "" && rule.Direction != PolicyEmit && rule.Direction != PolicyReceive {
+			return fmt.Errorf("rule %d: invalid direction: %s", i, rule.Direction)
+		}
+		for _, patterns := range [][]string{rule.Nodes, rule.Labels, rule.Events} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("rule %d: invalid pattern %s: %v", i, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Allows returns whether the node with the given name and labels may emit or receive the event, and the index
+// of the deciding rule (-1 for the default effect).
+func (p *Policy) Allows(direction PolicyDirection, nodeName string, labels []string, eventName string) (bool, int) {
+	for i, rule := range p.Rules {
+		if rule.matches(direction, nodeName, labels, eventName) {
+			return rule.Effect == PolicyAllow, i
+		}
+	}
+	return p.Default != PolicyDeny, -1
+}
+
+func (r *PolicyRule) matches(direction PolicyDirection, nodeName string, labels []string, eventName string) bool {
+	if r.Direction != "" && r.Direction != direction {
+		return false
+	}
+	if len(r.Events) > 0 && !matchesAny(r.Events, eventName) {
+		return false
+	}
+	if len(r.Nodes) == 0 && len(r.Labels) == 0 {
+		return true
+	}
+	if matchesAny(r.Nodes, nodeName) {
+		return true
+	}
+	for _, label := range labels {
+		if matchesAny(r.Labels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeLabelsCache holds the labels of the other nodes, by node name.
+type nodeLabelsCache struct {
+	mutex       sync.RWMutex
+	labels      map[string][]string
+	lastRefresh time.Time
+}
+
+func newNodeLabelsCache() *nodeLabelsCache {
+	return &nodeLabelsCache{
+		labels: make(map[string][]string),
+	}
+}
+
+func (c *nodeLabelsCache) get(nodeName string) ([]string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	labels, ok := c.labels[nodeName]
+	return labels, ok
+}
+
+func (c *nodeLabelsCache) set(labels map[string][]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.labels = labels
+	c.lastRefresh = time.Now()
+}
+
+// shouldRefresh returns true if the last refresh is older than nodeLabelsRefreshInterval, and if so considers the
+// cache as refreshed so that concurrent callers do not refresh it too.
+func (c *nodeLabelsCache) shouldRefresh() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.lastRefresh) < nodeLabelsRefreshInterval {
+		return false
+	}
+	c.lastRefresh = time.Now()
+	return true
+}
+
+// RefreshNodeLabels fetches the labels of the registered nodes from the registration server.
+func (n *Node) RefreshNodeLabels() error {
+	if n.RegistrationServer == nil {
+		return fmt.Errorf("no registration server configured")
+	}
+	nodes, err := n.RegistrationServer.FetchNodesInfo()
+	if err != nil {
+		return fmt.Errorf("could not fetch nodes info: %v", err)
+	}
+	labels := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		labels[node.NodeInfo.Name] = node.NodeInfo.Labels
+	}
+	n.nodeLabels.set(labels)
+	return nil
+}
+
+// labelsOf returns the cached labels of a node. If the node is unknown, the labels are refreshed in the
+// background, so that the events are never blocked by the registration server.
+func (n *Node) labelsOf(nodeName string) []string {
+	if nodeName == n.Info.Name {
+		return n.Info.Labels
+	}
+	labels, ok := n.nodeLabels.get(nodeName)
+	if !ok && n.RegistrationServer != nil && n.nodeLabels.shouldRefresh() {
+		// The node may have registered since the last refresh
+		go func() {
+			if err := n.RefreshNodeLabels(); err != nil {
+				n.Logger.Warnf("could not refresh the labels of the nodes: %v", err)
+			}
+		}()
+	}
+	return labels
+}
+
+// SetPolicy sets the access-control policy enforced by the node on the events it emits and receives.
+// A nil policy allows all the events.
+func (n *Node) SetPolicy(policy *Policy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("invalid policy: %v", err)
+		}
+	}
+
+	n.policyMutex.Lock()
+	n.policy = policy
+	n.policyMutex.Unlock()
+
+	if policy != nil && n.RegistrationServer != nil {
+		// Getting the labels of the other nodes
+		if err := n.RefreshNodeLabels(); err != nil {
+			n.Logger.Debugf("could not refresh nodes info: %v", err)
+		}
+	}
+	n.Logger.Info("access-control policy updated")
+	return nil
+}
+
+// checkPolicy returns an error if the policy denies the event to be sent or received by this node:
+// both the emitter must be allowed to emit it, and the receiver (this node when receiving) to receive it.
+// Broadcast events are only checked against the receive rules on reception.
+func (n *Node) checkPolicy(event *Event, sending bool) error {
+	n.policyMutex.RLock()
+	policy := n.policy
+	n.policyMutex.RUnlock()
+	if policy == nil {
+		return nil
+	}
+
+	checks := []struct {
+		direction PolicyDirection
+		nodeName  string
+	}{
+		{PolicyEmit, event.Emitter},
+		{PolicyReceive, n.Info.Name},
+	}
+	if sending {
+		if event.Receiver == "" || event.Receiver == "*" {
+			checks = checks[:1]
+		} else {
+			checks[1].nodeName = event.Receiver
+		}
+	}
+
+	for _, check := range checks {
+		labels := n.labelsOf(check.nodeName)
+		if allowed, rule := policy.Allows(check.direction, check.nodeName, labels, event.Name); !allowed {
+			n.recordDenial(PolicyDenial{
+				Time:      time.Now().UTC(),
+				Direction: check.direction,
+				Node:      check.nodeName,
+				EventName: event.Name,
+				EventId:   event.Id,
+				Emitter:   event.Emitter,
+				Receiver:  event.Receiver,
+				Rule:      rule,
+			})
+			return fmt.Errorf("%s is not allowed to %s %s", check.nodeName, check.direction, event.Name)
+		}
+	}
+	return nil
+}
+
+func (n *Node) recordDenial(denial PolicyDenial) {
+	n.Logger.WithField("security", true).WithFields(log.Fields{
+		"event":     denial.EventName,
+		"event_id":  denial.EventId,
+		"emitter":   denial.Emitter,
+		"receiver":  denial.Receiver,
+		"direction": denial.Direction,
+		"rule":      denial.Rule,
+	}).Warnf("event denied by policy: %s is not allowed to %s %s", denial.Node, denial.Direction, denial.EventName)
+
+	n.policyMutex.Lock()
+	defer n.policyMutex.Unlock()
+	n.policyDenials = append(n.policyDenials, denial)
+	if len(n.policyDenials) > maxPolicyDenials {
+		n.policyDenials = n.policyDenials[len(n.policyDenials)-maxPolicyDenials:]
+	}
+}
+
+// ServePolicy serves the policy of the node and the last denied events on /policy.
+func (n *Node) ServePolicy() {
+	n.Router.GET("/policy", func(c *gin.Context) {
+		n.policyMutex.RLock()
+		status := PolicyStatus{
+			Policy:  n.policy,
+			Denials: append([]PolicyDenial{}, n.policyDenials...),
+		}
+		n.policyMutex.RUnlock()
+		c.JSON(http.StatusOK, status)
+	})
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	policy := &Policy{
+		Default: PolicyDeny,
+		Rules: []PolicyRule{
+			{Effect: PolicyDeny, Direction: PolicyEmit, Nodes: []string{"kiosk-*"}, Events: []string{"ADMIN_*"}},
+			{Effect: PolicyAllow, Direction: PolicyReceive, Labels: []string{"display"}, Events: []string{"SHOW_*"}},
+			{Effect: PolicyAllow, Nodes: []string{"kiosk-*"}},
+			{Effect: PolicyAllow, Labels: []string{"admin"}},
+		},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		direction PolicyDirection
+		node      string
+		labels    []string
+		event     string
+		allowed   bool
+		rule      int
+	}{
+		{"denied emission", PolicyEmit, "kiosk-1", nil, "ADMIN_RESET", false, 0},
+		{"deny rule of another direction", PolicyReceive, "kiosk-1", nil, "ADMIN_RESET", true, 2},
+		{"allowed by name", PolicyEmit, "kiosk-1", nil, "I_BUTTON_PRESSED", true, 2},
+		{"allowed by label", PolicyReceive, "screen", []string{"display"}, "SHOW_IMAGE", true, 1},
+		{"label rule of another event", PolicyReceive, "screen", []string{"display"}, "PLAY_SOUND", false, -1},
+		{"any label", PolicyEmit, "laptop", []string{"display", "admin"}, "ADMIN_RESET", true, 3},
+		{"default", PolicyEmit, "laptop", nil, "PING", false, -1},
+		{"unregistered node", PolicyEmit, "unknown", nil, "SHOW_IMAGE", false, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, rule := policy.Allows(tt.direction, tt.node, tt.labels, tt.event)
+			if allowed != tt.allowed || rule != tt.rule {
+				t.Errorf("Allows = %v (rule %d), want %v (rule %d)", allowed, rule, tt.allowed, tt.rule)
+			}
+		})
+	}
+}
+
+func TestPolicyDefaultEffect(t *testing.T) {
+	tests := []struct {
+		effect  PolicyEffect
+		allowed bool
+	}{
+		{"", true},
+		{PolicyAllow, true},
+		{PolicyDeny, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.effect), func(t *testing.T) {
+			policy := &Policy{Default: tt.effect}
+			if allowed, _ := policy.Allows(PolicyEmit, "node", nil, "PING"); allowed != tt.allowed {
+				t.Errorf("Allows = %v, want %v", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"empty", Policy{}, false},
+		{"valid", Policy{Default: PolicyDeny, Rules: []PolicyRule{{Effect: PolicyAllow, Events: []string{"I_*"}}}}, false},
+		{"invalid default", Policy{Default: "maybe"}, true},
+		{"invalid effect", Policy{Rules: []PolicyRule{{Effect: "maybe"}}}, true},
+		{"invalid direction", Policy{Rules: []PolicyRule{{Effect: PolicyAllow, Direction: "both"}}}, true},
+		{"invalid pattern", Policy{Rules: []PolicyRule{{Effect: PolicyAllow, Labels: []string{"[a-"}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	emitter := newTestNode(t, "emitter", bus)
+	receiver := newTestNode(t, "receiver", bus)
+
+	if err := emitter.SetPolicy(&Policy{Rules: []PolicyRule{
+		{Effect: PolicyDeny, Direction: PolicyEmit, Nodes: []string{"emitter"}, Events: []string{"ADMIN_*"}},
+	}}); err != nil {
+		t.Fatalf("could not set the policy: %v", err)
+	}
+	if err := receiver.SetPolicy(&Policy{Rules: []PolicyRule{
+		{Effect: PolicyDeny, Direction: PolicyReceive, Nodes: []string{"receiver"}, Events: []string{"SECRET"}},
+	}}); err != nil {
+		t.Fatalf("could not set the policy: %v", err)
+	}
+
+	handled := make(chan *Event, 4)
+	receiver.OnEventDo("SECRET", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	receiver.OnEventDo("ADMIN_RESET", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	startTestNode(emitter)
+	startTestNode(receiver)
+
+	t.Run("denied emission", func(t *testing.T) {
+		if err := emitter.SendEventTo("receiver", "ADMIN_RESET", ""); err == nil {
+			t.Error("the event is sent")
+		}
+		expectNoEvent(t, handled)
+		checkPolicyDenials(t, emitter, PolicyEmit, "emitter", "ADMIN_RESET")
+	})
+
+	t.Run("denied reception", func(t *testing.T) {
+		if err := emitter.SendEventTo("receiver", "SECRET", ""); err != nil {
+			t.Fatalf("could not send the event: %v", err)
+		}
+		expectNoEvent(t, handled)
+		checkPolicyDenials(t, receiver, PolicyReceive, "receiver", "SECRET")
+	})
+}
+
+// checkPolicyDenials checks that the only denial listed on /policy is the expected one.
+func checkPolicyDenials(t *testing.T, n *Node, direction PolicyDirection, nodeName, eventName string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	n.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/policy", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+	var status PolicyStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("could not decode the policy status: %v", err)
+	}
+	if len(status.Denials) != 1 {
+		t.Fatalf("denials = %+v, want one", status.Denials)
+	}
+	denial := status.Denials[0]
+	if denial.Direction != direction || denial.Node != nodeName || denial.EventName != eventName {
+		t.Errorf("denial = %+v, want %s denied to %s %s", denial, nodeName, direction, eventName)
+	}
+}
+
+func TestPolicyLabelsRefreshedInTheBackground(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_ = json.NewEncoder(w).Encode([]RegisteredNode{{NodeInfo: NodeInfo{Name: "screen", Labels: []string{"display"}}}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	if err := n.SetPolicy(&Policy{Default: PolicyDeny, Rules: []PolicyRule{
+		{Effect: PolicyAllow, Labels: []string{"display"}},
+	}}); err != nil {
+		t.Fatalf("could not set the policy: %v", err)
+	}
+	n.Info.Labels = []string{"display"}
+	n.RegistrationServer = NewDefaultRegistrationServer(server.Listener.Addr().String())
+
+	// The registration server does not answer yet, the node is checked without its labels
+	start := time.Now()
+	if err := n.checkPolicy(&Event{Name: "SHOW_IMAGE", Emitter: "screen"}, false); err == nil {
+		t.Error("the event is allowed without the labels of its emitter")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("checked in %s, the policy waits for the registration server", elapsed)
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(testTimeout)
+	for {
+		if _, ok := n.nodeLabels.get("screen"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the labels are not refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := n.checkPolicy(&Event{Name: "SHOW_IMAGE", Emitter: "screen"}, false); err != nil {
+		t.Errorf("the event is denied once the labels are refreshed: %v", err)
+	}
+}
@@ -5,14 +5,75 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
+	"strings"
+	"sync"
+	"time"
 )
 
-const EventsExchange = "events"
+const (
+	// EventsExchange is the fanout exchange used by the RoutingModeFanout
+	EventsExchange = "events"
+	// EventsTopicExchange is the topic exchange used by the RoutingModeTopic
+	EventsTopicExchange = "events.topic"
+)
+
+// RoutingMode defines how events are routed by the broker.
+//
+// With RoutingModeFanout (the default), every node receives every event and the node filters them.
+//
+// With RoutingModeTopic, events are published on the EventsTopicExchange with the routing key
+// broadcast.<event name> or node.<receiver>.<event name>, and each node only binds its queue to
+// the broadcast events it has registered actions for, and to the events sent to it.
+// The topic exchange is bound to the fanout one, so that nodes still using RoutingModeFanout keep
+// receiving all the events. The reverse is not true: all the emitters must use RoutingModeTopic
+// for their events to be received by nodes using RoutingModeTopic.
+type RoutingMode string
+
+const (
+	RoutingModeFanout RoutingMode = "fanout"
+	RoutingModeTopic  RoutingMode = "topic"
+)
+
+// EnvelopeHeader is the AMQP header holding the JSON encoded envelope of events with a binary payload,
+// when the JSONCodec is used. Such events are published with their raw data as body, and the content type
+// of the payload, to avoid base64 encoding the payload in the JSON envelope.
+const EnvelopeHeader = "demokit-envelope"
+
+const (
+	DefaultOutboxSize        = 256
+	DefaultMinReconnectDelay = 500 * time.Millisecond
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
 
+// RabbitMQEventNetwork is the default EventNetwork, relying on a RabbitMQ broker.
+// The connection is automatically re-established when lost. While disconnected, outgoing events
+// are kept in a bounded outbox and sent once the connection is back.
 type RabbitMQEventNetwork struct {
-	rabbitMqChannel       *amqp.Channel
+	connDetails           ConnexionDetails
+	config                RabbitMQConfig
 	eventReceivedCallBack EventHandler
 	logger                *log.Entry
+
+	mutex           sync.Mutex
+	conn            *amqp.Connection
+	rabbitMqChannel *amqp.Channel
+	state           ConnectionState
+	reconnecting    bool
+	listening       bool
+	outbox          []rabbitMQMessage
+	nodeName        string
+	queueName       string
+	subscriptions   map[string]bool
+}
+
+type rabbitMQMessage struct {
+	routingKey string
+	publishing amqp.Publishing
+}
+
+// rabbitMQPublisher is the part of amqp.Channel used to send the events.
+type rabbitMQPublisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
 }
 
 type ConnexionDetails struct {
@@ -22,22 +83,244 @@ type ConnexionDetails struct {
 	Port     string
 }
 
+// RabbitMQConfig configures the behaviour of the RabbitMQEventNetwork when the broker is unreachable.
+// OutboxSize is the maximum number of events kept while disconnected, the oldest ones being dropped first.
+// The delay between two connection attempts doubles from MinReconnectDelay up to MaxReconnectDelay.
+// RoutingMode defines how events are routed, see RoutingMode for details.
+// Codec is used to encode the sent events, the received ones being decoded according to their content type.
+type RabbitMQConfig struct {
+	OutboxSize        int
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+	RoutingMode       RoutingMode
+	Codec             Codec
+}
+
+func DefaultRabbitMQConfig() RabbitMQConfig {
+	return RabbitMQConfig{
+		OutboxSize:        DefaultOutboxSize,
+		MinReconnectDelay: DefaultMinReconnectDelay,
+		MaxReconnectDelay: DefaultMaxReconnectDelay,
+		RoutingMode:       RoutingModeFanout,
+		Codec:             JSONCodec,
+	}
+}
+
 func NewRabbitMQEventNetwork(connDetails ConnexionDetails) *RabbitMQEventNetwork {
+	return NewRabbitMQEventNetworkWithConfig(connDetails, DefaultRabbitMQConfig())
+}
+
+// NewRabbitMQEventNetworkWithConfig returns a network connected to the broker described by connDetails.
+// If the broker cannot be reached, the network is returned anyway and keeps trying to connect in the background.
+func NewRabbitMQEventNetworkWithConfig(connDetails ConnexionDetails, config RabbitMQConfig) *RabbitMQEventNetwork {
 	logger := log.WithField("node", "na-event-network-setup")
 
+	if config.OutboxSize < 0 {
+		config.OutboxSize = 0
+	}
+	if config.MinReconnectDelay <= 0 {
+		config.MinReconnectDelay = DefaultMinReconnectDelay
+	}
+	if config.MaxReconnectDelay < config.MinReconnectDelay {
+		config.MaxReconnectDelay = config.MinReconnectDelay
+	}
+	if config.RoutingMode == "" {
+		config.RoutingMode = RoutingModeFanout
+	}
+	if config.RoutingMode != RoutingModeFanout && config.RoutingMode != RoutingModeTopic {
+		logger.Fatalf("unknown routing mode: %s", config.RoutingMode)
+	}
+	if config.Codec == nil {
+		config.Codec = JSONCodec
+	}
+
+	r := &RabbitMQEventNetwork{
+		connDetails:   connDetails,
+		config:        config,
+		logger:        logger.WithField("component", "event-network"),
+		state:         ConnectionStateConnecting,
+		outbox:        make([]rabbitMQMessage, 0),
+		subscriptions: make(map[string]bool),
+	}
+
+	if err := r.connect(); err != nil {
+		r.logger.Warnf("could not connect to RabbitMQ, will keep retrying: %v", err)
+		r.mutex.Lock()
+		r.startReconnecting()
+		r.mutex.Unlock()
+	}
+
+	return r
+}
+
+func (r *RabbitMQEventNetwork) BroadcastEvent(event *Event) {
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+
+	publishing := amqp.Publishing{
+		ContentType:   r.config.Codec.ContentType(),
+		MessageId:     event.Id,
+		Timestamp:     event.Timestamp,
+		CorrelationId: event.CorrelationId,
+	}
+
+	if event.IsBinary() && r.config.Codec == JSONCodec {
+		envelope, err := json.Marshal(envelopeOf(event))
+		if err != nil {
+			r.logger.Errorf("could not marshal event: %v", err)
+			return
+		}
+		publishing.ContentType = event.PayloadContentType()
+		publishing.Headers = amqp.Table{EnvelopeHeader: string(envelope)}
+		publishing.Body = event.Data
+	} else {
+		data, err := r.config.Codec.Encode(event)
+		if err != nil {
+			r.logger.Errorf("could not marshal event: %v", err)
+			return
+		}
+		publishing.Body = data
+	}
+
+	r.publish(rabbitMQMessage{
+		routingKey: r.routingKeyFor(event),
+		publishing: publishing,
+	})
+}
+
+func (r *RabbitMQEventNetwork) SendEventTo(receiver string, event *Event) {
+	event.Receiver = receiver
+	r.BroadcastEvent(event)
+}
+
+func (r *RabbitMQEventNetwork) SetReceivedEventCallback(handler EventHandler) {
+	r.eventReceivedCallBack = handler
+}
+
+func (r *RabbitMQEventNetwork) StartListeningForEvents() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.listening = true
+	if r.rabbitMqChannel == nil {
+		r.logger.Info("Not connected yet, will start listening for events once connected")
+		return
+	}
+
+	if err := r.consume(r.rabbitMqChannel); err != nil {
+		r.logger.Errorf("could not start listening for events: %v", err)
+		r.conn.Close()
+		return
+	}
+
+	r.logger.Info("Listening for events...")
+}
+
+func (r *RabbitMQEventNetwork) SetLogger(logger *log.Entry) {
+	r.logger = logger
+}
+
+func (r *RabbitMQEventNetwork) SetNodeName(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nodeName = name
+}
+
+// Subscribe makes sure the broadcast events with the given name are delivered to this node.
+// It only has an effect with RoutingModeTopic, every event being received with RoutingModeFanout.
+func (r *RabbitMQEventNetwork) Subscribe(eventName string) {
+	if r.config.RoutingMode != RoutingModeTopic {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.subscriptions[eventName] {
+		return
+	}
+	r.subscriptions[eventName] = true
+
+	// Otherwise, the binding will be done when the queue is declared
+	if r.rabbitMqChannel != nil && r.queueName != "" {
+		if err := r.bind(r.rabbitMqChannel, r.queueName, broadcastRoutingKeyFor(eventName)); err != nil {
+			r.logger.Errorf("could not subscribe to %s: %v", eventName, err)
+		}
+	}
+}
+
+// Unsubscribe stops the delivery of the broadcast events with the given name, see Subscribe.
+func (r *RabbitMQEventNetwork) Unsubscribe(eventName string) {
+	if r.config.RoutingMode != RoutingModeTopic {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.subscriptions[eventName] {
+		return
+	}
+	delete(r.subscriptions, eventName)
+
+	if r.rabbitMqChannel != nil && r.queueName != "" {
+		if err := r.unbind(r.rabbitMqChannel, r.queueName, broadcastRoutingKeyFor(eventName)); err != nil {
+			r.logger.Errorf("could not unsubscribe from %s: %v", eventName, err)
+		}
+	}
+}
+
+// ConnectionState returns the current state of the connection to the broker.
+func (r *RabbitMQEventNetwork) ConnectionState() ConnectionState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.state
+}
+
+func (r *RabbitMQEventNetwork) publish(msg rabbitMQMessage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.rabbitMqChannel != nil {
+		err := r.rabbitMqChannel.Publish(
+			r.exchange(),
+			msg.routingKey,
+			false,
+			false,
+			msg.publishing)
+		if err == nil {
+			return
+		}
+		r.logger.Errorf("could not send event, keeping it for later: %v", err)
+	}
+
+	if r.config.OutboxSize == 0 {
+		r.logger.Warn("not connected to RabbitMQ, dropping event")
+		return
+	}
+	if len(r.outbox) >= r.config.OutboxSize {
+		r.logger.Warn("outbox full, dropping the oldest event")
+		r.outbox = r.outbox[1:]
+	}
+	r.outbox = append(r.outbox, msg)
+}
+
+// connect dials the broker, declares the exchange, restores the consumer if the network was listening
+// and flushes the outbox.
+func (r *RabbitMQEventNetwork) connect() error {
 	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		connDetails.Username,
-		connDetails.Password,
-		connDetails.Host,
-		connDetails.Port,
+		r.connDetails.Username,
+		r.connDetails.Password,
+		r.connDetails.Host,
+		r.connDetails.Port,
 	))
 	if err != nil {
-		logger.Fatalf("failed to connect to RabbitMQ: %v", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
-		logger.Fatalf("failed to open a Channel: %v", err)
+		conn.Close()
+		return fmt.Errorf("failed to open a Channel: %v", err)
 	}
 
 	// setting up the different exchange
@@ -49,52 +332,75 @@ func NewRabbitMQEventNetwork(connDetails ConnexionDetails) *RabbitMQEventNetwork
 		false,
 		false,
 		nil)
-
 	if err != nil {
-		logger.Fatalf("could not declare the events exchange: %v", err)
+		conn.Close()
+		return fmt.Errorf("could not declare the events exchange: %v", err)
 	}
 
-	return &RabbitMQEventNetwork{
-		rabbitMqChannel: ch,
-		logger:          logger.WithField("component", "event-network"),
-	}
-}
+	if r.config.RoutingMode == RoutingModeTopic {
+		err = ch.ExchangeDeclare(
+			EventsTopicExchange,
+			"topic",
+			true,
+			false,
+			false,
+			false,
+			nil)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("could not declare the events topic exchange: %v", err)
+		}
 
-func (r *RabbitMQEventNetwork) BroadcastEvent(event *Event) {
-	if event.Receiver == "" {
-		event.Receiver = "*"
+		// Forwarding everything to the fanout exchange, for the nodes not using the topic routing
+		if err := ch.ExchangeBind(EventsExchange, "#", EventsTopicExchange, false, nil); err != nil {
+			conn.Close()
+			return fmt.Errorf("could not bind the events exchanges: %v", err)
+		}
 	}
 
-	data, err := json.Marshal(event)
-	if err != nil {
-		r.logger.Errorf("could not marshal event: %v", err)
-	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
-	err = r.rabbitMqChannel.Publish(
-		EventsExchange,
-		"",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        data,
-		})
-	if err != nil {
-		r.logger.Errorf("could not send event: %v", err)
+	if r.listening {
+		if err := r.consume(ch); err != nil {
+			conn.Close()
+			return err
+		}
+		r.logger.Info("Listening for events...")
 	}
-}
 
-func (r *RabbitMQEventNetwork) SendEventTo(receiver string, event *Event) {
-	event.Receiver = receiver
-	r.BroadcastEvent(event)
+	r.conn = conn
+	r.rabbitMqChannel = ch
+	r.state = ConnectionStateConnected
+	r.reconnecting = false
+	r.logger.Info("Connected to RabbitMQ")
+
+	go r.watch(conn, ch)
+
+	r.flushOutbox(ch)
+	return nil
 }
 
-func (r *RabbitMQEventNetwork) SetReceivedEventCallback(handler EventHandler) {
-	r.eventReceivedCallBack = handler
+// flushOutbox sends the events kept while disconnected, in order. The events that cannot be sent are kept for the
+// next connection. It must be called with the mutex held.
+func (r *RabbitMQEventNetwork) flushOutbox(ch rabbitMQPublisher) {
+	if len(r.outbox) > 0 {
+		r.logger.Infof("sending %d events kept while disconnected", len(r.outbox))
+	}
+	for len(r.outbox) > 0 {
+		msg := r.outbox[0]
+		if err := ch.Publish(r.exchange(), msg.routingKey, false, false, msg.publishing); err != nil {
+			r.logger.Errorf("could not flush outbox: %v", err)
+			return
+		}
+		r.outbox = r.outbox[1:]
+	}
 }
 
-func (r *RabbitMQEventNetwork) StartListeningForEvents() {
-	q, err := r.rabbitMqChannel.QueueDeclare(
+// consume declares the exclusive queue of this node, binds it to the exchange and starts delivering
+// the received events to the callback. It must be called with the mutex held.
+func (r *RabbitMQEventNetwork) consume(ch *amqp.Channel) error {
+	q, err := ch.QueueDeclare(
 		"",    // name
 		false, // durable
 		false, // delete when unused
@@ -103,23 +409,18 @@ func (r *RabbitMQEventNetwork) StartListeningForEvents() {
 		nil,   // arguments
 	)
 	if err != nil {
-		r.logger.Fatalf("failed to declare a queue: %v", err)
+		return fmt.Errorf("failed to declare a queue: %v", err)
 	}
 	r.logger.Debugf("queue %s declared", q.Name)
 
-	err = r.rabbitMqChannel.QueueBind(
-		q.Name,         // queue name
-		"",             // routing key
-		EventsExchange, // exchange
-		false,
-		nil,
-	)
-	if err != nil {
-		r.logger.Fatalf("failed to bind a queue: %v", err)
+	for _, routingKey := range r.bindingKeys() {
+		if err := r.bind(ch, q.Name, routingKey); err != nil {
+			return err
+		}
 	}
-	r.logger.Debugf("Successfully bound to queue %s", q.Name)
+	r.queueName = q.Name
 
-	msgs, err := r.rabbitMqChannel.Consume(
+	msgs, err := ch.Consume(
 		q.Name, // queue
 		"",     // consumer
 		true,   // auto-ack
@@ -129,23 +430,178 @@ func (r *RabbitMQEventNetwork) StartListeningForEvents() {
 		nil,    // args
 	)
 	if err != nil {
-		r.logger.Fatalf("failed to register a consumer: %v", err)
+		return fmt.Errorf("failed to register a consumer: %v", err)
 	}
 
+	// The loop ends when the channel is closed, a new consumer is set up on reconnection
 	go func() {
 		for d := range msgs {
-			var event Event
-			err := json.Unmarshal(d.Body, &event)
+			event, err := decodeRabbitMQDelivery(d)
 			if err != nil {
 				r.logger.Warnf("could not unmarshal event: %v", err)
+				continue
 			}
-			r.eventReceivedCallBack(&event)
+			r.eventReceivedCallBack(event)
 		}
 	}()
 
-	r.logger.Info("Listening for events...")
+	return nil
 }
 
-func (r *RabbitMQEventNetwork) SetLogger(logger *log.Entry) {
-	r.logger = logger
+func decodeRabbitMQDelivery(d amqp.Delivery) (*Event, error) {
+	envelope, ok := d.Headers[EnvelopeHeader].(string)
+	if !ok {
+		codec, err := CodecFor(d.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Decode(d.Body)
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(envelope), &event); err != nil {
+		return nil, err
+	}
+	event.Data = d.Body
+	if event.Data == nil {
+		event.Data = []byte{}
+	}
+	return &event, nil
+}
+
+func (r *RabbitMQEventNetwork) bind(ch *amqp.Channel, queueName, routingKey string) error {
+	err := ch.QueueBind(
+		queueName,    // queue name
+		routingKey,   // routing key
+		r.exchange(), // exchange
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bind a queue: %v", err)
+	}
+	r.logger.Debugf("Successfully bound to queue %s (routing key: '%s')", queueName, routingKey)
+	return nil
+}
+
+func (r *RabbitMQEventNetwork) unbind(ch *amqp.Channel, queueName, routingKey string) error {
+	err := ch.QueueUnbind(
+		queueName,    // queue name
+		routingKey,   // routing key
+		r.exchange(), // exchange
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unbind a queue: %v", err)
+	}
+	r.logger.Debugf("Successfully unbound from queue %s (routing key: '%s')", queueName, routingKey)
+	return nil
+}
+
+// bindingKeys returns the routing keys the queue of this node must be bound with.
+// It must be called with the mutex held.
+func (r *RabbitMQEventNetwork) bindingKeys() []string {
+	if r.config.RoutingMode != RoutingModeTopic {
+		return []string{""}
+	}
+
+	keys := make([]string, 0, len(r.subscriptions)+1)
+	if r.nodeName != "" {
+		keys = append(keys, fmt.Sprintf("node.%s.#", routingKeyWord(r.nodeName)))
+	} else {
+		r.logger.Warn("node name unknown, unicast events will not be received")
+	}
+	for eventName := range r.subscriptions {
+		keys = append(keys, broadcastRoutingKeyFor(eventName))
+	}
+	return keys
+}
+
+func (r *RabbitMQEventNetwork) exchange() string {
+	if r.config.RoutingMode == RoutingModeTopic {
+		return EventsTopicExchange
+	}
+	return EventsExchange
+}
+
+func (r *RabbitMQEventNetwork) routingKeyFor(event *Event) string {
+	if r.config.RoutingMode != RoutingModeTopic {
+		return ""
+	}
+	if event.Receiver == "*" {
+		return broadcastRoutingKeyFor(event.Name)
+	}
+	return fmt.Sprintf("node.%s.%s", routingKeyWord(event.Receiver), event.Name)
+}
+
+func broadcastRoutingKeyFor(eventName string) string {
+	if eventName == AllEvents {
+		return "broadcast.#"
+	}
+	return fmt.Sprintf("broadcast.%s", eventName)
+}
+
+// routingKeyWord makes sure a node name is a single word of a routing key.
+func routingKeyWord(name string) string {
+	return strings.NewReplacer(".", "_", "*", "_", "#", "_").Replace(name)
+}
+
+// watch waits for the connection or the channel to be closed, and starts reconnecting.
+func (r *RabbitMQEventNetwork) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chanClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-chanClosed:
+	}
+	conn.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.conn != conn {
+		return
+	}
+	r.logger.Warnf("connection to RabbitMQ lost: %v", reason)
+	r.conn = nil
+	r.rabbitMqChannel = nil
+	r.queueName = ""
+	r.startReconnecting()
+}
+
+// startReconnecting starts the reconnection loop, unless it is already running.
+// It must be called with the mutex held.
+func (r *RabbitMQEventNetwork) startReconnecting() {
+	r.state = ConnectionStateDisconnected
+	if r.reconnecting {
+		return
+	}
+	r.reconnecting = true
+
+	go func() {
+		delay := r.config.MinReconnectDelay
+		for {
+			time.Sleep(delay)
+
+			r.mutex.Lock()
+			r.state = ConnectionStateConnecting
+			r.mutex.Unlock()
+
+			err := r.connect()
+			if err == nil {
+				return
+			}
+
+			r.mutex.Lock()
+			r.state = ConnectionStateDisconnected
+			r.mutex.Unlock()
+
+			delay *= 2
+			if delay > r.config.MaxReconnectDelay {
+				delay = r.config.MaxReconnectDelay
+			}
+			r.logger.Warnf("could not reconnect to RabbitMQ, retrying in %s: %v", delay, err)
+		}
+	}()
 }
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"fmt"
+	"github.com/streadway/amqp"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestRabbitMQEventNetwork returns a network that is not connected to any broker.
+func newTestRabbitMQEventNetwork(config RabbitMQConfig) *RabbitMQEventNetwork {
+	return &RabbitMQEventNetwork{
+		config:        config,
+		logger:        newTestLogger(),
+		state:         ConnectionStateDisconnected,
+		outbox:        make([]rabbitMQMessage, 0),
+		subscriptions: make(map[string]bool),
+	}
+}
+
+// fakeRabbitMQChannel records the routing key and the name of the published events, and fails once limit events are
+// published if limit is set.
+type fakeRabbitMQChannel struct {
+	limit     int
+	exchanges []string
+	published []string
+}
+
+func (f *fakeRabbitMQChannel) Publish(exchange, key string, _, _ bool, msg amqp.Publishing) error {
+	if f.limit > 0 && len(f.published) >= f.limit {
+		return fmt.Errorf("channel closed")
+	}
+	event, err := JSONCodec.Decode(msg.Body)
+	if err != nil {
+		return err
+	}
+	f.exchanges = append(f.exchanges, exchange)
+	f.published = append(f.published, key+":"+event.Name)
+	return nil
+}
+
+func outboxEventNames(r *RabbitMQEventNetwork) []string {
+	names := make([]string, 0, len(r.outbox))
+	for _, msg := range r.outbox {
+		event, _ := JSONCodec.Decode(msg.publishing.Body)
+		names = append(names, msg.routingKey+":"+event.Name)
+	}
+	return names
+}
+
+func TestRabbitMQOutbox(t *testing.T) {
+	tests := []struct {
+		name       string
+		outboxSize int
+		routing    RoutingMode
+		// Number of events the channel accepts before failing, 0 for no limit
+		limit int
+		// Routing keys and names of the events, the routing key being empty with the fanout routing
+		published []string
+		kept      []string
+	}{
+		{"flushed in order", 3, RoutingModeFanout, 0, []string{":C", ":D", ":E"}, []string{}},
+		{"failing channel", 3, RoutingModeFanout, 1, []string{":C"}, []string{":D", ":E"}},
+		{"topic routing", 2, RoutingModeTopic, 0, []string{"broadcast.D:D", "node.b.E:E"}, []string{}},
+		{"no outbox", 0, RoutingModeFanout, 0, nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRabbitMQConfig()
+			config.OutboxSize = tt.outboxSize
+			config.RoutingMode = tt.routing
+			r := newTestRabbitMQEventNetwork(config)
+
+			// Sent while disconnected, the oldest events being dropped once the outbox is full
+			for _, name := range []string{"A", "B", "C", "D"} {
+				r.BroadcastEvent(&Event{Name: name})
+			}
+			r.SendEventTo("b", &Event{Name: "E"})
+
+			// As done by connect once the connection is back
+			ch := &fakeRabbitMQChannel{limit: tt.limit}
+			r.mutex.Lock()
+			r.flushOutbox(ch)
+			r.mutex.Unlock()
+
+			for _, exchange := range ch.exchanges {
+				if exchange != r.exchange() {
+					t.Errorf("published on %s, want %s", exchange, r.exchange())
+				}
+			}
+			if !reflect.DeepEqual(ch.published, tt.published) {
+				t.Errorf("published %v, want %v", ch.published, tt.published)
+			}
+			if kept := outboxEventNames(r); !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestRabbitMQRoutingKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		routing  RoutingMode
+		receiver string
+		event    string
+		key      string
+	}{
+		{"fanout broadcast", RoutingModeFanout, "*", "PING", ""},
+		{"fanout unicast", RoutingModeFanout, "b", "PING", ""},
+		{"broadcast", RoutingModeTopic, "*", "PING", "broadcast.PING"},
+		{"unicast", RoutingModeTopic, "b", "PING", "node.b.PING"},
+		{"receiver with a dot", RoutingModeTopic, "kiosk.1", "PING", "node.kiosk_1.PING"},
+		{"receiver with wildcards", RoutingModeTopic, "*kiosk#", "PING", "node._kiosk_.PING"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRabbitMQConfig()
+			config.RoutingMode = tt.routing
+			r := newTestRabbitMQEventNetwork(config)
+			if key := r.routingKeyFor(&Event{Name: tt.event, Receiver: tt.receiver}); key != tt.key {
+				t.Errorf("routing key = %q, want %q", key, tt.key)
+			}
+		})
+	}
+}
+
+func TestRabbitMQBroadcastRoutingKeys(t *testing.T) {
+	tests := []struct {
+		event string
+		key   string
+	}{
+		{"PING", "broadcast.PING"},
+		{AllEvents, "broadcast.#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			if key := broadcastRoutingKeyFor(tt.event); key != tt.key {
+				t.Errorf("routing key = %q, want %q", key, tt.key)
+			}
+		})
+	}
+}
+
+func TestRabbitMQBindingKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		routing       RoutingMode
+		nodeName      string
+		subscriptions []string
+		keys          []string
+	}{
+		{"fanout", RoutingModeFanout, "a", []string{"PING"}, []string{""}},
+		{"topic", RoutingModeTopic, "kiosk.1", []string{"PING", "PONG"},
+			[]string{"broadcast.PING", "broadcast.PONG", "node.kiosk_1.#"}},
+		{"all events", RoutingModeTopic, "a", []string{AllEvents}, []string{"broadcast.#", "node.a.#"}},
+		{"no node name", RoutingModeTopic, "", []string{"PING"}, []string{"broadcast.PING"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRabbitMQConfig()
+			config.RoutingMode = tt.routing
+			r := newTestRabbitMQEventNetwork(config)
+			r.SetNodeName(tt.nodeName)
+			for _, eventName := range tt.subscriptions {
+				r.Subscribe(eventName)
+			}
+
+			r.mutex.Lock()
+			keys := r.bindingKeys()
+			r.mutex.Unlock()
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("binding keys = %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/SINTEF-Infosec/demokit/hardware"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scenario wires events to chains of built-in steps, so that demos can be authored without writing Go code.
+// Scenarios are written in YAML or JSON, e.g.:
+//
+//	name: welcome
+//	on:
+//	  - event: VISITOR_DETECTED
+//	    steps:
+//	      - delay: 2s
+//	      - led_message: {text: Welcome!, color: [0, 255, 0]}
+//	      - media_load: /videos/welcome.mp4
+//	      - media: play
+//	      - broadcast: {event: WELCOME_PLAYED}
+//
+// See ScenarioStep for the available steps.
+type Scenario struct {
+	Name       string            `yaml:"name"`
+	EntryPoint []ScenarioStep    `yaml:"entry_point"`
+	On         []ScenarioTrigger `yaml:"on"`
+}
+
+// ScenarioTrigger executes its steps when an event named Event is received. Pattern and Emitter can be used
+// instead to match the events with glob patterns, see EventPattern.
+type ScenarioTrigger struct {
+	Event       string          `yaml:"event"`
+	Pattern     string          `yaml:"pattern"`
+	Emitter     string          `yaml:"emitter"`
+	Priority    int             `yaml:"priority"`
+	Concurrency ConcurrencyMode `yaml:"concurrency"`
+	Window      int             `yaml:"window"`
+	Steps       []ScenarioStep  `yaml:"steps"`
+}
+
+// ScenarioStep is one of the built-in steps, exactly one of its fields must be set:
+//   - delay: waits for a duration, e.g. 500ms or 2s
+//   - broadcast: broadcasts an event, with an optional payload (a string, or an object encoded in JSON)
+//   - send: sends an event to the node named by to
+//   - media: play, pause, mute or stop
+//   - media_load: loads a media from a path or an URL
+//   - led_message: scrolls a text on the LED matrix of the hardware layer, in color (white by default)
+//   - led_clear: clears the LED matrix
+//   - log: logs a message
+//   - set_state: sets values in the scenario state, served on /scenario/state
+//
+// When the hardware layer has no LED matrix, the LED steps only log their text.
+type ScenarioStep struct {
+	Delay      string                 `yaml:"delay"`
+	Broadcast  *ScenarioEvent         `yaml:"broadcast"`
+	Send       *ScenarioEvent         `yaml:"send"`
+	Media      string                 `yaml:"media"`
+	MediaLoad  string                 `yaml:"media_load"`
+	LedMessage *ScenarioLedMessage    `yaml:"led_message"`
+	LedClear   bool                   `yaml:"led_clear"`
+	Log        string                 `yaml:"log"`
+	SetState   map[string]interface{} `yaml:"set_state"`
+}
+
+// ScenarioEvent is the event emitted by the broadcast and send steps.
+type ScenarioEvent struct {
+	To      string      `yaml:"to"`
+	Event   string      `yaml:"event"`
+	Payload interface{} `yaml:"payload"`
+}
+
+type ScenarioLedMessage struct {
+	Text  string  `yaml:"text"`
+	Color []uint8 `yaml:"color"`
+}
+
+// ParseScenario parses a scenario written in YAML or JSON.
+func ParseScenario(data []byte) (*Scenario, error) {
+	var scenario Scenario
+	if err := yaml.UnmarshalStrict(data, &scenario); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// LoadScenario reads a scenario file and applies it to the node, see ApplyScenario.
+func (n *Node) LoadScenario(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read scenario: %v", err)
+	}
+	scenario, err := ParseScenario(data)
+	if err != nil {
+		return fmt.Errorf("could not parse scenario %s: %v", path, err)
+	}
+	return n.ApplyScenario(scenario)
+}
+
+// ApplyScenario registers the actions of the scenario, and sets its entry point if any.
+// Nothing is registered if the scenario is invalid.
+func (n *Node) ApplyScenario(scenario *Scenario) error {
+	type trigger struct {
+		ScenarioTrigger
+		action *Action
+	}
+
+	var entryPoint *Action
+	if len(scenario.EntryPoint) > 0 {
+		var err error
+		if entryPoint, err = n.scenarioAction(scenario.Name+" entry point", scenario.EntryPoint); err != nil {
+			return fmt.Errorf("entry point: %v", err)
+		}
+	}
+
+	triggers := make([]trigger, 0, len(scenario.On))
+	for i, t := range scenario.On {
+		if (t.Event == "") == (t.Pattern == "") {
+			return fmt.Errorf("trigger %d: either event or pattern must be set", i)
+		}
+		if t.Emitter != "" && t.Pattern == "" {
+			return fmt.Errorf("trigger %d: emitter requires a pattern", i)
+		}
+		if !t.Concurrency.isValid() {
+			return fmt.Errorf("trigger %d: invalid concurrency mode %s", i, t.Concurrency)
+		}
+		if _, err := newEventMatcher(EventPattern{Name: t.Pattern, Emitter: t.Emitter}); err != nil {
+			return fmt.Errorf("trigger %d: %v", i, err)
+		}
+		name := t.Event + t.Pattern
+		action, err := n.scenarioAction(fmt.Sprintf("%s on %s", scenario.Name, name), t.Steps)
+		if err != nil {
+			return fmt.Errorf("trigger %d (%s): %v", i, name, err)
+		}
+		action.Concurrency = t.Concurrency
+		action.ConcurrencyWindow = t.Window
+		triggers = append(triggers, trigger{ScenarioTrigger: t, action: action})
+	}
+
+	for _, t := range triggers {
+		if t.Event != "" {
+			n.OnEventDoWithPriority(t.Event, t.Priority, t.action)
+			continue
+		}
+		// The pattern has been validated above
+		_, _ = n.OnPatternDoWithPriority(EventPattern{Name: t.Pattern, Emitter: t.Emitter}, t.Priority, t.action)
+	}
+	if entryPoint != nil {
+		n.SetEntryPoint(entryPoint)
+	}
+	n.Logger.Infof("scenario %s applied: %d trigger(s)", scenario.Name, len(triggers))
+	return nil
+}
+
+// ScenarioState returns a copy of the values set by the set_state steps.
+func (n *Node) ScenarioState() map[string]interface{} {
+	return n.scenarioState.copy()
+}
+
+// ServeScenarioState serves the values set by the set_state steps on /scenario/state.
+func (n *Node) ServeScenarioState() {
+	n.Router.GET("/scenario/state", func(c *gin.Context) {
+		c.JSON(http.StatusOK, n.ScenarioState())
+	})
+}
+
+// scenarioState holds the values set by the set_state steps.
+type scenarioState struct {
+	mutex  sync.Mutex
+	values map[string]interface{}
+}
+
+func newScenarioState() *scenarioState {
+	return &scenarioState{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (s *scenarioState) set(values map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, value := range values {
+		s.values[key] = value
+	}
+}
+
+func (s *scenarioState) copy() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make(map[string]interface{}, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values
+}
+
+// scenarioAction builds the chain of actions executing the steps.
+func (n *Node) scenarioAction(name string, steps []ScenarioStep) (*Action, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no steps")
+	}
+
+	var first, last *Action
+	for i := range steps {
+		action, err := n.scenarioStepAction(&steps[i])
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %v", i, err)
+		}
+		if first == nil {
+			first = action
+		} else {
+			last.Then = action
+		}
+		last = action
+	}
+
+	// The chain is named after the scenario in the status, executions and failures
+	first.Name = fmt.Sprintf("%s: %s", name, first.Name)
+	return first, nil
+}
+
+func (n *Node) scenarioStepAction(step *ScenarioStep) (*Action, error) {
+	var actions []*Action
+
+	if step.Delay != "" {
+		delay, err := time.ParseDuration(step.Delay)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid delay %s", step.Delay)
+		}
+		actions = append(actions, &Action{
+			Name:    "delay " + step.Delay,
+			DoDelay: int(delay / time.Millisecond),
+			// The step only waits, but needs a body for the chain to go on
+			Do: func(_ *Event) {},
+		})
+	}
+
+	if step.Broadcast != nil {
+		if step.Broadcast.Event == "" {
+			return nil, fmt.Errorf("broadcast requires an event")
+		}
+		payload, err := scenarioPayload(step.Broadcast.Payload)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, n.BroadcastEventAction(step.Broadcast.Event, payload))
+	}
+
+	if step.Send != nil {
+		if step.Send.Event == "" || step.Send.To == "" {
+			return nil, fmt.Errorf("send requires an event and a receiver")
+		}
+		payload, err := scenarioPayload(step.Send.Payload)
+		if err != nil {
+			return nil, err
+		}
+		receiver, eventName := step.Send.To, step.Send.Event
+		actions = append(actions, &Action{
+			Name: fmt.Sprintf("send %s to %s", eventName, receiver),
+			DoContext: func(_ context.Context, _ *Event) error {
+				return n.SendEventTo(receiver, eventName, payload)
+			},
+		})
+	}
+
+	if step.Media != "" {
+		action, err := n.mediaAction(step.Media)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	if step.MediaLoad != "" {
+		source := step.MediaLoad
+		actions = append(actions, &Action{
+			Name: "load media " + source,
+			DoContext: func(_ context.Context, _ *Event) error {
+				if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+					return n.MediaController.LoadMediaFromURL(source)
+				}
+				return n.MediaController.LoadMediaFromPath(source)
+			},
+		})
+	}
+
+	if step.LedMessage != nil {
+		color := hardware.Color{R: 255, G: 255, B: 255}
+		switch len(step.LedMessage.Color) {
+		case 0:
+		case 3:
+			color = hardware.Color{R: step.LedMessage.Color[0], G: step.LedMessage.Color[1], B: step.LedMessage.Color[2]}
+		default:
+			return nil, fmt.Errorf("invalid color %v, expected [r, g, b]", step.LedMessage.Color)
+		}
+		text := step.LedMessage.Text
+		actions = append(actions, &Action{
+			Name: "show LED message",
+			DoContext: func(_ context.Context, _ *Event) error {
+				if matrix, ok := n.Hardware.(hardware.LedMatrix); ok {
+					return matrix.ShowText(text, color)
+				}
+				n.Logger.Infof("no LED matrix, message: %s", text)
+				return nil
+			},
+		})
+	}
+
+	if step.LedClear {
+		actions = append(actions, &Action{
+			Name: "clear LEDs",
+			DoContext: func(_ context.Context, _ *Event) error {
+				if matrix, ok := n.Hardware.(hardware.LedMatrix); ok {
+					return matrix.ClearLeds()
+				}
+				return nil
+			},
+		})
+	}
+
+	if step.Log != "" {
+		message := step.Log
+		actions = append(actions, &Action{
+			Name: "log",
+			Do: func(_ *Event) {
+				n.Logger.Info(message)
+			},
+		})
+	}
+
+	if step.SetState != nil {
+		values := make(map[string]interface{}, len(step.SetState))
+		for key, value := range step.SetState {
+			values[key] = jsonCompatible(value)
+		}
+		actions = append(actions, &Action{
+			Name: "set state",
+			Do: func(_ *Event) {
+				n.scenarioState.set(values)
+			},
+		})
+	}
+
+	if len(actions) != 1 {
+		return nil, fmt.Errorf("exactly one step kind must be set, got %d", len(actions))
+	}
+	return actions[0], nil
+}
+
+func (n *Node) mediaAction(command string) (*Action, error) {
+	switch command {
+	case "play", "pause", "mute", "stop":
+	default:
+		return nil, fmt.Errorf("unknown media command %s", command)
+	}
+	return &Action{
+		Name: "media " + command,
+		DoContext: func(_ context.Context, _ *Event) error {
+			switch command {
+			case "play":
+				return n.MediaController.Play()
+			case "pause":
+				return n.MediaController.Pause()
+			case "mute":
+				return n.MediaController.Mute()
+			default:
+				return n.MediaController.Stop()
+			}
+		},
+	}, nil
+}
+
+// scenarioPayload returns the payload of an event step: strings are used as is, other values are encoded in JSON.
+func scenarioPayload(payload interface{}) (string, error) {
+	switch p := payload.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return p, nil
+	}
+	data, err := json.Marshal(jsonCompatible(payload))
+	if err != nil {
+		return "", fmt.Errorf("invalid payload: %v", err)
+	}
+	return string(data), nil
+}
+
+// jsonCompatible converts the maps decoded from YAML, keyed by interface{}, to maps keyed by string.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+	return value
+}
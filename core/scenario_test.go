@@ -0,0 +1,90 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyScenarioValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario string
+		wantErr  bool
+	}{
+		{"event trigger", "on:\n  - event: PING\n    steps:\n      - log: ping\n", false},
+		{"pattern trigger", "on:\n  - pattern: I_*\n    emitter: kiosk-*\n    steps:\n      - media: play\n", false},
+		{"entry point", "entry_point:\n  - delay: 1s\n  - broadcast: {event: READY}\n", false},
+		{"json", `{"on": [{"event": "PING", "steps": [{"send": {"to": "b", "event": "PONG"}}]}]}`, false},
+		{"unknown field", "on:\n  - event: PING\n    steps:\n      - sleep: 1s\n", true},
+		{"no steps", "on:\n  - event: PING\n", true},
+		{"event and pattern", "on:\n  - event: PING\n    pattern: P*\n    steps:\n      - log: ping\n", true},
+		{"emitter without pattern", "on:\n  - event: PING\n    emitter: a\n    steps:\n      - log: ping\n", true},
+		{"invalid pattern", "on:\n  - pattern: '[a-'\n    steps:\n      - log: ping\n", true},
+		{"invalid concurrency", "on:\n  - event: PING\n    concurrency: often\n    steps:\n      - log: ping\n", true},
+		{"invalid delay", "on:\n  - event: PING\n    steps:\n      - delay: soon\n", true},
+		{"two kinds in a step", "on:\n  - event: PING\n    steps:\n      - {log: ping, media: play}\n", true},
+		{"empty step", "on:\n  - event: PING\n    steps:\n      - {}\n", true},
+		{"broadcast without event", "on:\n  - event: PING\n    steps:\n      - broadcast: {payload: x}\n", true},
+		{"send without receiver", "on:\n  - event: PING\n    steps:\n      - send: {event: PONG}\n", true},
+		{"unknown media command", "on:\n  - event: PING\n    steps:\n      - media: rewind\n", true},
+		{"invalid color", "on:\n  - event: PING\n    steps:\n      - led_message: {text: hi, color: [1, 2]}\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNode(t, "node", NewInMemoryEventBus())
+			scenario, err := ParseScenario([]byte(tt.scenario))
+			if err == nil {
+				err = n.ApplyScenario(scenario)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil && (len(n.actions) > 0 || len(n.patternActions) > 0) {
+				t.Error("actions registered by an invalid scenario")
+			}
+		})
+	}
+}
+
+func TestScenarioExecution(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	n := newTestNode(t, "node", bus)
+	other := newTestNode(t, "other", bus)
+
+	scenario, err := ParseScenario([]byte(`
+name: test
+on:
+  - event: PING
+    steps:
+      - delay: 10ms
+      - set_state: {answered: true, count: 1}
+      - send: {to: other, event: PONG, payload: {answer: 42}}
+`))
+	if err != nil {
+		t.Fatalf("could not parse the scenario: %v", err)
+	}
+	if err := n.ApplyScenario(scenario); err != nil {
+		t.Fatalf("could not apply the scenario: %v", err)
+	}
+
+	received := make(chan *Event, 1)
+	other.OnEventDo("PONG", &Action{Name: "record", Do: func(event *Event) { received <- event }})
+	startTestNode(n)
+	startTestNode(other)
+
+	start := time.Now()
+	if err := other.SendEventTo("node", "PING", ""); err != nil {
+		t.Fatalf("could not send the event: %v", err)
+	}
+	event := waitForEvent(t, received)
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("answered after %s, before the delay", elapsed)
+	}
+	if event.Payload != `{"answer":42}` {
+		t.Errorf("payload = %s, want {\"answer\":42}", event.Payload)
+	}
+	state := n.ScenarioState()
+	if state["answered"] != true || state["count"] != 1 {
+		t.Errorf("state = %v, want answered and count set", state)
+	}
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ScheduleId identifies a scheduled action, see CancelSchedule.
+type ScheduleId uint64
+
+type ScheduleKind string
+
+const (
+	ScheduleEvery ScheduleKind = "every"
+	ScheduleAfter ScheduleKind = "after"
+	ScheduleCron  ScheduleKind = "cron"
+)
+
+// ScheduleInfo describes a scheduled action, as listed in the node status.
+// NextRun is not set until the node is started.
+type ScheduleInfo struct {
+	Id      ScheduleId   `json:"id"`
+	Kind    ScheduleKind `json:"kind"`
+	Spec    string       `json:"spec"`
+	Action  string       `json:"action"`
+	NextRun *time.Time   `json:"next_run,omitempty"`
+	Runs    uint64       `json:"runs"`
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+type scheduledAction struct {
+	info      ScheduleInfo
+	schedule  cron.Schedule
+	once      bool
+	scheduler *actionScheduler
+	cancel    context.CancelFunc
+}
+
+// schedules holds the scheduled actions of a node.
+type schedules struct {
+	mutex     sync.Mutex
+	lastId    ScheduleId
+	scheduled map[ScheduleId]*scheduledAction
+}
+
+func newSchedules() *schedules {
+	return &schedules{
+		scheduled: make(map[ScheduleId]*scheduledAction),
+	}
+}
+
+func (s *schedules) list() []ScheduleInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	infos := make([]ScheduleInfo, 0, len(s.scheduled))
+	for _, scheduled := range s.scheduled {
+		infos = append(infos, scheduled.info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id < infos[j].Id
+	})
+	return infos
+}
+
+// Every executes the action every interval, starting one interval after the node is started.
+// If an execution lasts longer than the interval, the missed runs are skipped, unless the concurrency mode of the
+// action allows overlapping executions (see Action.Concurrency).
+func (n *Node) Every(interval time.Duration, action *Action) (ScheduleId, error) {
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval %s", interval)
+	}
+	return n.schedule(ScheduleEvery, interval.String(), intervalSchedule{interval: interval}, false, action)
+}
+
+// After executes the action once, delay after the node is started (or after the call if already started).
+func (n *Node) After(delay time.Duration, action *Action) (ScheduleId, error) {
+	if delay < 0 {
+		return 0, fmt.Errorf("invalid delay %s", delay)
+	}
+	return n.schedule(ScheduleAfter, delay.String(), intervalSchedule{interval: delay}, true, action)
+}
+
+// Cron executes the action according to a cron expression, e.g. "0 14 * * *" for every day at 14:00
+// (local time, unless prefixed with CRON_TZ=<zone>), or descriptors such as "@hourly".
+func (n *Node) Cron(expression string, action *Action) (ScheduleId, error) {
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron expression %s: %v", expression, err)
+	}
+	return n.schedule(ScheduleCron, expression, schedule, false, action)
+}
+
+// BroadcastEventAction returns an action broadcasting an event, to be scheduled or chained with other actions.
+func (n *Node) BroadcastEventAction(eventName, payload string) *Action {
+	return &Action{
+		Name: fmt.Sprintf("broadcast %s", eventName),
+		DoContext: func(_ context.Context, _ *Event) error {
+			return n.BroadcastEvent(eventName, payload)
+		},
+	}
+}
+
+// CancelSchedule cancels a scheduled action. Running executions are not cancelled, see CancelExecution.
+// It returns false if no such action is scheduled.
+func (n *Node) CancelSchedule(id ScheduleId) bool {
+	n.schedules.mutex.Lock()
+	scheduled, ok := n.schedules.scheduled[id]
+	delete(n.schedules.scheduled, id)
+	n.schedules.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	scheduled.cancel()
+	n.Logger.Infof("schedule %d of %s cancelled", id, scheduled.info.Action)
+	return true
+}
+
+// Schedules returns the scheduled actions.
+func (n *Node) Schedules() []ScheduleInfo {
+	return n.schedules.list()
+}
+
+// ServeSchedules serves the scheduled actions on /schedules, and allows to cancel them with DELETE /schedules/:id.
+func (n *Node) ServeSchedules() {
+	n.Router.GET("/schedules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, n.Schedules())
+	})
+
+	n.Router.DELETE("/schedules/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid schedule id")
+			return
+		}
+		if !n.CancelSchedule(ScheduleId(id)) {
+			c.String(http.StatusNotFound, "no schedule with id %d", id)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+}
+
+func (n *Node) schedule(kind ScheduleKind, spec string, schedule cron.Schedule, once bool,
+	action *Action) (ScheduleId, error) {
+	if action == nil {
+		return 0, fmt.Errorf("cannot schedule a nil action")
+	}
+
+	ctx, cancel := context.WithCancel(n.ctx)
+	scheduled := &scheduledAction{
+		schedule:  schedule,
+		once:      once,
+		scheduler: newActionScheduler(n, action),
+		cancel:    cancel,
+	}
+
+	n.schedules.mutex.Lock()
+	n.schedules.lastId++
+	scheduled.info = ScheduleInfo{
+		Id:     n.schedules.lastId,
+		Kind:   kind,
+		Spec:   spec,
+		Action: action.Name,
+	}
+	n.schedules.scheduled[scheduled.info.Id] = scheduled
+	n.schedules.mutex.Unlock()
+
+	go n.runSchedule(ctx, scheduled)
+	n.Logger.Infof("action scheduled: %s %s -> %s (id: %d)", kind, spec, action.Name, scheduled.info.Id)
+	return scheduled.info.Id, nil
+}
+
+// runSchedule triggers the scheduled action until the schedule is cancelled or the node stops.
+// Nothing is triggered before the node is started.
+func (n *Node) runSchedule(ctx context.Context, scheduled *scheduledAction) {
+	defer func() {
+		n.schedules.mutex.Lock()
+		delete(n.schedules.scheduled, scheduled.info.Id)
+		n.schedules.mutex.Unlock()
+	}()
+
+	select {
+	case <-n.started:
+	case <-ctx.Done():
+		return
+	}
+
+	next := time.Now()
+	for {
+		next = scheduled.schedule.Next(next)
+		if now := time.Now(); next.Before(now) {
+			// Skipping the runs missed during a long execution
+			next = scheduled.schedule.Next(now)
+		}
+		if next.IsZero() {
+			return
+		}
+
+		nextRun := next
+		n.schedules.mutex.Lock()
+		scheduled.info.NextRun = &nextRun
+		n.schedules.mutex.Unlock()
+
+		if !sleepContext(ctx, time.Until(next)) {
+			return
+		}
+
+		n.schedules.mutex.Lock()
+		scheduled.info.Runs++
+		n.schedules.mutex.Unlock()
+
+		scheduled.scheduler.trigger(nil)
+		if scheduled.once {
+			return
+		}
+	}
+}
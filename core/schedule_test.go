@@ -0,0 +1,109 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// countingAction returns an action sending an event to the returned channel each time it is executed.
+func countingAction() (*Action, <-chan *Event) {
+	runs := make(chan *Event, 64)
+	return &Action{Name: "count", Concurrency: ConcurrencyParallel, Do: func(_ *Event) {
+		runs <- &Event{Name: "RUN"}
+	}}, runs
+}
+
+func TestEvery(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	action, runs := countingAction()
+	id, err := n.Every(10*time.Millisecond, action)
+	if err != nil {
+		t.Fatalf("could not schedule the action: %v", err)
+	}
+	startTestNode(n)
+
+	for i := 0; i < 3; i++ {
+		waitForEvent(t, runs)
+	}
+	schedules := n.Schedules()
+	if len(schedules) != 1 || schedules[0].Id != id || schedules[0].Runs < 3 || schedules[0].NextRun == nil {
+		t.Errorf("schedules = %+v, want the action run 3 times", schedules)
+	}
+
+	if !n.CancelSchedule(id) {
+		t.Fatal("the schedule is not found")
+	}
+	// An execution may have been triggered before the cancellation
+	time.Sleep(20 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	expectNoEvent(t, runs)
+	if schedules := n.Schedules(); len(schedules) != 0 {
+		t.Errorf("schedules = %+v, want none", schedules)
+	}
+}
+
+func TestScheduleWaitsForTheStart(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	action, runs := countingAction()
+	if _, err := n.After(0, action); err != nil {
+		t.Fatalf("could not schedule the action: %v", err)
+	}
+
+	expectNoEvent(t, runs)
+	if schedules := n.Schedules(); len(schedules) != 1 || schedules[0].NextRun != nil {
+		t.Errorf("schedules = %+v, want the action not planned yet", schedules)
+	}
+
+	startTestNode(n)
+	waitForEvent(t, runs)
+	expectNoEvent(t, runs)
+}
+
+func TestScheduleStopsWithTheNode(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	action, runs := countingAction()
+	if _, err := n.Every(10*time.Millisecond, action); err != nil {
+		t.Fatalf("could not schedule the action: %v", err)
+	}
+	startTestNode(n)
+	waitForEvent(t, runs)
+
+	n.stop()
+	time.Sleep(20 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	expectNoEvent(t, runs)
+}
+
+func TestInvalidSchedules(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	noop := &Action{Name: "noop", Do: func(_ *Event) {}}
+	tests := []struct {
+		name     string
+		schedule func() (ScheduleId, error)
+		wantErr  bool
+	}{
+		{"cron expression", func() (ScheduleId, error) { return n.Cron("0 14 * * *", noop) }, false},
+		{"cron descriptor", func() (ScheduleId, error) { return n.Cron("@hourly", noop) }, false},
+		{"invalid minute", func() (ScheduleId, error) { return n.Cron("61 * * * *", noop) }, true},
+		{"missing field", func() (ScheduleId, error) { return n.Cron("0 14 * *", noop) }, true},
+		{"not a cron expression", func() (ScheduleId, error) { return n.Cron("every day", noop) }, true},
+		{"invalid interval", func() (ScheduleId, error) { return n.Every(0, noop) }, true},
+		{"invalid delay", func() (ScheduleId, error) { return n.After(-time.Second, noop) }, true},
+		{"nil action", func() (ScheduleId, error) { return n.Every(time.Second, nil) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.schedule()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil {
+				n.CancelSchedule(id)
+			}
+		})
+	}
+}
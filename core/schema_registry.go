@@ -0,0 +1,112 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xeipuuv/gojsonschema"
+	"strings"
+	"sync"
+)
+
+// InvalidPayloadHeader is set on the received events whose payload does not match the declared schema,
+// when the node is not configured to reject them (see NodeConfig.RejectInvalidEvents).
+const InvalidPayloadHeader = "demokit-invalid-payload"
+
+// SchemaDirection tells whether a schema applies to the events emitted or consumed by a node.
+type SchemaDirection string
+
+const (
+	SchemaEmitted  SchemaDirection = "emitted"
+	SchemaConsumed SchemaDirection = "consumed"
+)
+
+// SchemaRegistry holds the JSON Schemas of the payloads of the events emitted and consumed by a node.
+type SchemaRegistry struct {
+	mutex   sync.RWMutex
+	schemas map[SchemaDirection]map[string]*registeredSchema
+}
+
+type registeredSchema struct {
+	source json.RawMessage
+	schema *gojsonschema.Schema
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemas: map[SchemaDirection]map[string]*registeredSchema{
+			SchemaEmitted:  make(map[string]*registeredSchema),
+			SchemaConsumed: make(map[string]*registeredSchema),
+		},
+	}
+}
+
+// Register declares the JSON Schema of the payload of the given event, replacing any previous declaration.
+func (r *SchemaRegistry) Register(direction SchemaDirection, eventName, schema string) error {
+	if direction != SchemaEmitted && direction != SchemaConsumed {
+		return fmt.Errorf("unknown schema direction: %s", direction)
+	}
+	if !json.Valid([]byte(schema)) {
+		return fmt.Errorf("schema of %s is not valid JSON", eventName)
+	}
+
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		return fmt.Errorf("invalid schema for %s: %v", eventName, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.schemas[direction][eventName] = &registeredSchema{
+		source: json.RawMessage(schema),
+		schema: compiled,
+	}
+	return nil
+}
+
+// Validate checks the payload of the event against the schema declared for its name, if any.
+func (r *SchemaRegistry) Validate(direction SchemaDirection, event *Event) error {
+	r.mutex.RLock()
+	registered, ok := r.schemas[direction][event.Name]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	payload := []byte(event.Payload)
+	if event.IsBinary() {
+		if event.PayloadContentType() != ContentTypeJSON {
+			return fmt.Errorf("a schema is declared for %s, but its payload is %s", event.Name, event.PayloadContentType())
+		}
+		payload = event.Data
+	}
+	if !json.Valid(payload) {
+		return fmt.Errorf("payload of %s is not valid JSON", event.Name)
+	}
+
+	result, err := registered.schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return fmt.Errorf("could not validate payload of %s: %v", event.Name, err)
+	}
+	if !result.Valid() {
+		errs := make([]string, 0, len(result.Errors()))
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return fmt.Errorf("invalid payload for %s: %s", event.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Schemas returns the declared schemas, by direction and event name.
+func (r *SchemaRegistry) Schemas() map[SchemaDirection]map[string]json.RawMessage {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	schemas := make(map[SchemaDirection]map[string]json.RawMessage, len(r.schemas))
+	for direction, registered := range r.schemas {
+		schemas[direction] = make(map[string]json.RawMessage, len(registered))
+		for eventName, s := range registered {
+			schemas[direction][eventName] = s.source
+		}
+	}
+	return schemas
+}
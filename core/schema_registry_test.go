@@ -0,0 +1,122 @@
+package core
+
+import "testing"
+
+const testSchema = `{
+	"type": "object",
+	"properties": {"level": {"type": "integer", "minimum": 0}},
+	"required": ["level"]
+}`
+
+func TestSchemaRegistryRegister(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction SchemaDirection
+		schema    string
+		wantErr   bool
+	}{
+		{"valid", SchemaConsumed, testSchema, false},
+		{"unknown direction", "both", testSchema, true},
+		{"invalid JSON", SchemaEmitted, `{"type":`, true},
+		{"invalid schema", SchemaEmitted, `{"type": 42}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewSchemaRegistry()
+			err := registry.Register(tt.direction, "LEVEL", tt.schema)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if _, ok := registry.Schemas()[tt.direction]["LEVEL"]; ok == tt.wantErr {
+				t.Errorf("schema registered: %v, want %v", ok, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaRegistryValidate(t *testing.T) {
+	registry := NewSchemaRegistry()
+	if err := registry.Register(SchemaConsumed, "LEVEL", testSchema); err != nil {
+		t.Fatalf("could not register the schema: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		direction SchemaDirection
+		event     Event
+		wantErr   bool
+	}{
+		{"valid payload", SchemaConsumed, Event{Name: "LEVEL", Payload: `{"level":3}`}, false},
+		{"valid JSON data", SchemaConsumed, Event{Name: "LEVEL", ContentType: ContentTypeJSON, Data: []byte(`{"level":3}`)},
+			false},
+		{"no schema for the event", SchemaConsumed, Event{Name: "PING", Payload: "ping"}, false},
+		{"no schema for the direction", SchemaEmitted, Event{Name: "LEVEL", Payload: `{}`}, false},
+		{"missing property", SchemaConsumed, Event{Name: "LEVEL", Payload: `{}`}, true},
+		{"wrong type", SchemaConsumed, Event{Name: "LEVEL", Payload: `{"level":"high"}`}, true},
+		{"out of range", SchemaConsumed, Event{Name: "LEVEL", Payload: `{"level":-1}`}, true},
+		{"not JSON", SchemaConsumed, Event{Name: "LEVEL", Payload: "level 3"}, true},
+		{"binary data", SchemaConsumed, Event{Name: "LEVEL", ContentType: "image/png", Data: []byte{0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.Validate(tt.direction, &tt.event); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		rejectEvents bool
+		payload      string
+		// Whether the action is executed, and the event flagged as invalid
+		handled bool
+		flagged bool
+	}{
+		{"valid payload", false, `{"level":3}`, true, false},
+		{"invalid payload", false, `{"level":"high"}`, true, true},
+		{"invalid payload rejected", true, `{"level":"high"}`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewInMemoryEventBus()
+			emitter := newTestNode(t, "emitter", bus)
+			receiver := newTestNode(t, "receiver", bus)
+			receiver.Config.RejectInvalidEvents = tt.rejectEvents
+			if err := receiver.DeclareEventSchema(SchemaConsumed, "LEVEL", testSchema); err != nil {
+				t.Fatalf("could not declare the schema: %v", err)
+			}
+			handled := make(chan *Event, 1)
+			receiver.OnEventDo("LEVEL", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+			startTestNode(emitter)
+			startTestNode(receiver)
+
+			if err := emitter.BroadcastEvent("LEVEL", tt.payload); err != nil {
+				t.Fatalf("could not send the event: %v", err)
+			}
+			if !tt.handled {
+				expectNoEvent(t, handled)
+				return
+			}
+			event := waitForEvent(t, handled)
+			if flagged := event.Header(InvalidPayloadHeader) != ""; flagged != tt.flagged {
+				t.Errorf("flagged as invalid: %v, want %v", flagged, tt.flagged)
+			}
+		})
+	}
+
+	t.Run("emitted event", func(t *testing.T) {
+		n := newTestNode(t, "node", NewInMemoryEventBus())
+		if err := n.DeclareEventSchema(SchemaEmitted, "LEVEL", testSchema); err != nil {
+			t.Fatalf("could not declare the schema: %v", err)
+		}
+		if err := n.BroadcastEvent("LEVEL", `{"level":3}`); err != nil {
+			t.Errorf("the valid event is not sent: %v", err)
+		}
+		if err := n.BroadcastEvent("LEVEL", `{}`); err == nil {
+			t.Error("the invalid event is sent")
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the base64 encoded signature of the event.
+	SignatureHeader = "demokit-signature"
+	// SignatureAlgorithmHeader holds the algorithm used to sign the event.
+	SignatureAlgorithmHeader = "demokit-signature-algorithm"
+	// UnverifiedEventHeader is set on the received events whose signature could not be verified, when the node
+	// is not configured to reject them (see NodeConfig.RequireSignedEvents). Its value is the reason of the failure.
+	UnverifiedEventHeader = "demokit-unverified"
+
+	// DefaultReplayWindow is the maximum age of a signed event, and the duration its id is remembered.
+	DefaultReplayWindow = 30 * time.Second
+)
+
+type SignatureAlgorithm string
+
+const (
+	SignatureHMACSHA256 SignatureAlgorithm = "hmac-sha256"
+	SignatureEd25519    SignatureAlgorithm = "ed25519"
+)
+
+// Signer signs the events emitted by a node, see Node.SetSigner.
+type Signer interface {
+	Algorithm() SignatureAlgorithm
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier verifies the signature of the events received from an emitter, see Node.TrustEmitter.
+type Verifier interface {
+	Algorithm() SignatureAlgorithm
+	Verify(message, signature []byte) error
+}
+
+// HMACKey is a shared secret key, both Signer and Verifier. It is the simplest option for a demo: all the nodes
+// knowing the key are trusted, but any of them can impersonate the others.
+type HMACKey struct {
+	key []byte
+}
+
+func NewHMACKey(key []byte) *HMACKey {
+	return &HMACKey{key: append([]byte{}, key...)}
+}
+
+func (k *HMACKey) Algorithm() SignatureAlgorithm {
+	return SignatureHMACSHA256
+}
+
+func (k *HMACKey) Sign(message []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+func (k *HMACKey) Verify(message, signature []byte) error {
+	expected, _ := k.Sign(message)
+	if !hmac.Equal(expected, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// Ed25519Signer signs events with the private key of a node, whose public key is given to the other nodes
+// with NewEd25519Verifier.
+type Ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+func NewEd25519Signer(privateKey ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{privateKey: privateKey}
+}
+
+func (s *Ed25519Signer) Algorithm() SignatureAlgorithm {
+	return SignatureEd25519
+}
+
+func (s *Ed25519Signer) Sign(message []byte) ([]byte, error) {
+	if len(s.privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key")
+	}
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+// PublicKey returns the public key to give to the nodes receiving the events.
+func (s *Ed25519Signer) PublicKey() ed25519.PublicKey {
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+type Ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+func NewEd25519Verifier(publicKey ed25519.PublicKey) *Ed25519Verifier {
+	return &Ed25519Verifier{publicKey: publicKey}
+}
+
+func (v *Ed25519Verifier) Algorithm() SignatureAlgorithm {
+	return SignatureEd25519
+}
+
+func (v *Ed25519Verifier) Verify(message, signature []byte) error {
+	if len(v.publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key")
+	}
+	if !ed25519.Verify(v.publicKey, message, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// KeyRing holds the verifiers of the trusted emitters. The verifier registered for "*" is used
+// for the emitters without a verifier of their own, e.g. with an HMACKey shared by all the nodes.
+type KeyRing struct {
+	mutex     sync.RWMutex
+	verifiers map[string]Verifier
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		verifiers: make(map[string]Verifier),
+	}
+}
+
+// Trust registers the verifier of the events emitted by emitter, replacing any previous one.
+func (k *KeyRing) Trust(emitter string, verifier Verifier) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.verifiers[emitter] = verifier
+}
+
+// Revoke removes the verifier of emitter.
+func (k *KeyRing) Revoke(emitter string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	delete(k.verifiers, emitter)
+}
+
+// IsEmpty returns true if no emitter is trusted.
+func (k *KeyRing) IsEmpty() bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return len(k.verifiers) == 0
+}
+
+func (k *KeyRing) verifierFor(emitter string) (Verifier, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	if verifier, ok := k.verifiers[emitter]; ok {
+		return verifier, true
+	}
+	verifier, ok := k.verifiers["*"]
+	return verifier, ok
+}
+
+// signEvent sets the signature headers of the event. It must be called once the envelope is complete.
+func signEvent(signer Signer, event *Event) error {
+	message, err := signedContent(event)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(message)
+	if err != nil {
+		return fmt.Errorf("could not sign event: %v", err)
+	}
+	event.SetHeader(SignatureAlgorithmHeader, string(signer.Algorithm()))
+	event.SetHeader(SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// verifyEvent checks the signature of the event against the verifier of its emitter.
+func verifyEvent(keyRing *KeyRing, event *Event) error {
+	encodedSignature := event.Header(SignatureHeader)
+	if encodedSignature == "" {
+		return fmt.Errorf("event is not signed")
+	}
+	verifier, ok := keyRing.verifierFor(event.Emitter)
+	if !ok {
+		return fmt.Errorf("no key for emitter %s", event.Emitter)
+	}
+	if algorithm := SignatureAlgorithm(event.Header(SignatureAlgorithmHeader)); algorithm != verifier.Algorithm() {
+		return fmt.Errorf("unexpected signature algorithm %s, expected %s", algorithm, verifier.Algorithm())
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+	message, err := signedContent(event)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(message, signature)
+}
+
+// signedContent returns the signed part of the event: its whole envelope, except the signature headers.
+// The JSON encoding is used whatever the codec of the event network, as it is deterministic.
+func signedContent(event *Event) ([]byte, error) {
+	signed := *event
+	signed.Headers = nil
+	for key, value := range event.Headers {
+		if key != SignatureHeader && key != SignatureAlgorithmHeader {
+			signed.SetHeader(key, value)
+		}
+	}
+	// Matching the envelope as received, the networks not distinguishing empty and missing data
+	if len(signed.Data) == 0 {
+		signed.Data = nil
+	}
+	signed.Timestamp = signed.Timestamp.UTC()
+
+	content, err := json.Marshal(&signed)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode event for signature: %v", err)
+	}
+	return content, nil
+}
+
+// replayGuard rejects the events that are too old, or whose id has already been seen.
+type replayGuard struct {
+	mutex     sync.Mutex
+	window    time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newReplayGuard(window time.Duration) *replayGuard {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	return &replayGuard{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (g *replayGuard) check(event *Event) error {
+	now := time.Now()
+	if event.Timestamp.IsZero() || event.Id == "" {
+		return fmt.Errorf("event has no timestamp or id")
+	}
+	if age := now.Sub(event.Timestamp); age > g.window || age < -g.window {
+		return fmt.Errorf("event timestamp %s is outside of the replay window", event.Timestamp.Format(time.RFC3339))
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if now.Sub(g.lastPrune) > g.window {
+		for id, seenAt := range g.seen {
+			if now.Sub(seenAt) > 2*g.window {
+				delete(g.seen, id)
+			}
+		}
+		g.lastPrune = now
+	}
+
+	key := event.Emitter + "/" + event.Id
+	if _, ok := g.seen[key]; ok {
+		return fmt.Errorf("event %s has already been received", event.Id)
+	}
+	g.seen[key] = now
+	return nil
+}
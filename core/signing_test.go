@@ -0,0 +1,167 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func newTestEd25519Key(t *testing.T) (*Ed25519Signer, *Ed25519Verifier) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	return NewEd25519Signer(privateKey), NewEd25519Verifier(publicKey)
+}
+
+func TestSignatureVerification(t *testing.T) {
+	hmacKey := NewHMACKey([]byte("secret"))
+	otherHMACKey := NewHMACKey([]byte("other secret"))
+	signer, verifier := newTestEd25519Key(t)
+	_, otherVerifier := newTestEd25519Key(t)
+
+	tests := []struct {
+		name      string
+		signer    Signer
+		trusted   map[string]Verifier
+		tamper    func(event *Event)
+		transport Codec
+		wantErr   bool
+	}{
+		{name: "hmac", signer: hmacKey, trusted: map[string]Verifier{"a": hmacKey}},
+		{name: "ed25519", signer: signer, trusted: map[string]Verifier{"a": verifier}},
+		{name: "any emitter", signer: hmacKey, trusted: map[string]Verifier{"*": hmacKey}},
+		{name: "json transport", signer: signer, trusted: map[string]Verifier{"a": verifier}, transport: JSONCodec},
+		{name: "cbor transport", signer: signer, trusted: map[string]Verifier{"a": verifier}, transport: CBORCodec},
+		{name: "unsigned", trusted: map[string]Verifier{"a": hmacKey}, wantErr: true},
+		{name: "unknown emitter", signer: hmacKey, trusted: map[string]Verifier{"b": hmacKey}, wantErr: true},
+		{name: "wrong hmac key", signer: hmacKey, trusted: map[string]Verifier{"a": otherHMACKey}, wantErr: true},
+		{name: "wrong ed25519 key", signer: signer, trusted: map[string]Verifier{"a": otherVerifier}, wantErr: true},
+		{name: "wrong algorithm", signer: hmacKey, trusted: map[string]Verifier{"a": verifier}, wantErr: true},
+		{
+			name:    "tampered payload",
+			signer:  signer,
+			trusted: map[string]Verifier{"a": verifier},
+			tamper:  func(event *Event) { event.Payload = `{"n":2}` },
+			wantErr: true,
+		},
+		{
+			name:    "spoofed emitter",
+			signer:  hmacKey,
+			trusted: map[string]Verifier{"*": hmacKey, "b": otherHMACKey},
+			tamper:  func(event *Event) { event.Emitter = "b" },
+			wantErr: true,
+		},
+		{
+			name:    "tampered header",
+			signer:  signer,
+			trusted: map[string]Verifier{"a": verifier},
+			tamper:  func(event *Event) { event.SetHeader("role", "admin") },
+			wantErr: true,
+		},
+		{
+			name:    "malformed signature",
+			signer:  signer,
+			trusted: map[string]Verifier{"a": verifier},
+			tamper:  func(event *Event) { event.SetHeader(SignatureHeader, "not base64!") },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{
+				Name:      "PING",
+				Emitter:   "a",
+				Receiver:  "*",
+				Payload:   `{"n":1}`,
+				Id:        "1",
+				Timestamp: time.Now().UTC(),
+				Version:   EventVersion,
+			}
+			if tt.signer != nil {
+				if err := signEvent(tt.signer, event); err != nil {
+					t.Fatalf("could not sign the event: %v", err)
+				}
+			}
+			if tt.tamper != nil {
+				tt.tamper(event)
+			}
+			if tt.transport != nil {
+				data, err := tt.transport.Encode(event)
+				if err != nil {
+					t.Fatalf("could not encode the event: %v", err)
+				}
+				if event, err = tt.transport.Decode(data); err != nil {
+					t.Fatalf("could not decode the event: %v", err)
+				}
+			}
+
+			keyRing := NewKeyRing()
+			for emitter, verifier := range tt.trusted {
+				keyRing.Trust(emitter, verifier)
+			}
+			if err := verifyEvent(keyRing, event); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayGuard(t *testing.T) {
+	window := time.Minute
+	guard := newReplayGuard(window)
+	now := time.Now().UTC()
+
+	// The events are checked in order by the same guard
+	tests := []struct {
+		name    string
+		event   *Event
+		wantErr bool
+	}{
+		{"first reception", &Event{Emitter: "a", Id: "1", Timestamp: now}, false},
+		{"replayed", &Event{Emitter: "a", Id: "1", Timestamp: now}, true},
+		{"same id from another emitter", &Event{Emitter: "b", Id: "1", Timestamp: now}, false},
+		{"another id", &Event{Emitter: "a", Id: "2", Timestamp: now.Add(-window / 2)}, false},
+		{"too old", &Event{Emitter: "a", Id: "3", Timestamp: now.Add(-2 * window)}, true},
+		{"too far in the future", &Event{Emitter: "a", Id: "4", Timestamp: now.Add(2 * window)}, true},
+		{"no id", &Event{Emitter: "a", Timestamp: now}, true},
+		{"no timestamp", &Event{Emitter: "a", Id: "5"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := guard.check(tt.event); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeRejectsUnsignedEvents(t *testing.T) {
+	bus := NewInMemoryEventBus()
+	key := NewHMACKey([]byte("secret"))
+	emitter := newTestNode(t, "emitter", bus)
+	spoofer := newTestNode(t, "spoofer", bus)
+	receiver := newTestNode(t, "receiver", bus)
+	emitter.SetSigner(key)
+	receiver.Config.RequireSignedEvents = true
+	receiver.TrustEmitter("emitter", key)
+
+	handled := make(chan *Event, 8)
+	receiver.OnEventDo("PING", &Action{Name: "record", Do: func(event *Event) { handled <- event }})
+	for _, n := range []*Node{emitter, spoofer, receiver} {
+		startTestNode(n)
+	}
+
+	if err := spoofer.EmitEvent(&Event{Name: "PING", Receiver: "receiver", Payload: `"spoofed"`}); err != nil {
+		t.Fatalf("could not send the event: %v", err)
+	}
+	if err := emitter.EmitEvent(&Event{Name: "PING", Receiver: "receiver", Payload: `"signed"`}); err != nil {
+		t.Fatalf("could not send the event: %v", err)
+	}
+	if event := waitForEvent(t, handled); event.Payload != `"signed"` {
+		t.Errorf("handled %s, want the signed event", event.Payload)
+	}
+	expectNoEvent(t, handled)
+}
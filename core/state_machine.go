@@ -0,0 +1,267 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StateChangedEvent is broadcast by a node on each transition of its state machine, with a StateChange payload.
+const StateChangedEvent = "STATE_CHANGED"
+
+// AnyState matches all the states in the From states of a Transition.
+const AnyState = "*"
+
+// StateMachine describes the states of a node and the transitions between them, see SetStateMachine.
+type StateMachine struct {
+	Initial     string
+	States      []State
+	Transitions []Transition
+}
+
+// State is a state of a StateMachine. OnEntry is executed when the state is entered, including when the node
+// starts in the initial state, and OnExit when the state is left.
+type State struct {
+	Name    string
+	OnEntry *Action
+	OnExit  *Action
+}
+
+// Transition moves the state machine from one of the From states (or AnyState) to the To state when an event
+// named Event is received, if Guard is nil or returns true. When several transitions are possible, the first one
+// declared is taken.
+// The OnExit action of the current state is executed first, then Do, and the OnEntry action of the new state once
+// the state has changed. If OnExit or Do fails, the transition is aborted.
+type Transition struct {
+	From  []string
+	To    string
+	Event string
+	Guard ActionCondition
+	Do    *Action
+}
+
+// StateChange is the payload of the StateChangedEvent.
+type StateChange struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Event string `json:"event"`
+}
+
+// StateMachineStatus describes the state machine of a node, as shown in the node status.
+type StateMachineStatus struct {
+	Current     string    `json:"current"`
+	Since       time.Time `json:"since"`
+	States      []string  `json:"states"`
+	Transitions uint64    `json:"transitions"`
+}
+
+type stateMachine struct {
+	definition *StateMachine
+	states     map[string]*State
+	// Held during the transitions, so that they are taken one at a time
+	transitionMutex sync.Mutex
+	// The initial state is entered once, before the first transition
+	entered sync.Once
+
+	mutex       sync.Mutex
+	current     string
+	since       time.Time
+	transitions uint64
+}
+
+func (t *Transition) leaves(state string) bool {
+	for _, from := range t.From {
+		if from == AnyState || from == state {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStateMachine sets the state machine of the node, starting in its initial state.
+// The transitions are handled in the event dispatcher of the node, one at a time, along with the other actions
+// registered for their events (see OnEventDo). Only one state machine can be set. If the node is already started,
+// the OnEntry action of the initial state is executed right away.
+func (n *Node) SetStateMachine(definition *StateMachine) error {
+	if definition == nil {
+		return fmt.Errorf("no state machine definition")
+	}
+	machine := &stateMachine{
+		definition: definition,
+		states:     make(map[string]*State, len(definition.States)),
+		current:    definition.Initial,
+		since:      time.Now().UTC(),
+	}
+	for i := range definition.States {
+		state := &definition.States[i]
+		if state.Name == "" || state.Name == AnyState {
+			return fmt.Errorf("invalid state name %q", state.Name)
+		}
+		if _, ok := machine.states[state.Name]; ok {
+			return fmt.Errorf("state %s declared twice", state.Name)
+		}
+		machine.states[state.Name] = state
+	}
+	if _, ok := machine.states[definition.Initial]; !ok {
+		return fmt.Errorf("unknown initial state %s", definition.Initial)
+	}
+
+	var eventNames []string
+	for i, transition := range definition.Transitions {
+		if transition.Event == "" {
+			return fmt.Errorf("transition %d has no event", i)
+		}
+		if len(transition.From) == 0 {
+			return fmt.Errorf("transition %d on %s has no from state", i, transition.Event)
+		}
+		for _, from := range transition.From {
+			if _, ok := machine.states[from]; !ok && from != AnyState {
+				return fmt.Errorf("transition %d on %s: unknown state %s", i, transition.Event, from)
+			}
+		}
+		if _, ok := machine.states[transition.To]; !ok {
+			return fmt.Errorf("transition %d on %s: unknown state %s", i, transition.Event, transition.To)
+		}
+		if !containsString(eventNames, transition.Event) {
+			eventNames = append(eventNames, transition.Event)
+		}
+	}
+
+	n.stateMachineMutex.Lock()
+	if n.stateMachine != nil {
+		n.stateMachineMutex.Unlock()
+		return fmt.Errorf("the state machine is already set")
+	}
+	n.stateMachine = machine
+	n.stateMachineMutex.Unlock()
+
+	for _, eventName := range eventNames {
+		n.OnEventDo(eventName, &Action{
+			Name:      "state machine",
+			DoContext: n.handleTransition,
+		})
+	}
+	n.Logger.Infof("state machine configured: %d states, initial state %s", len(machine.states), machine.current)
+
+	select {
+	case <-n.started:
+		go n.enterInitialState()
+	default:
+		// The initial state is entered when the node starts
+	}
+	return nil
+}
+
+// CurrentState returns the current state of the state machine of the node, or "" if not set.
+func (n *Node) CurrentState() string {
+	machine := n.getStateMachine()
+	if machine == nil {
+		return ""
+	}
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+	return machine.current
+}
+
+func (n *Node) getStateMachine() *stateMachine {
+	n.stateMachineMutex.Lock()
+	defer n.stateMachineMutex.Unlock()
+	return n.stateMachine
+}
+
+func (n *Node) getStateMachineStatus() *StateMachineStatus {
+	machine := n.getStateMachine()
+	if machine == nil {
+		return nil
+	}
+	states := make([]string, 0, len(machine.definition.States))
+	for _, state := range machine.definition.States {
+		states = append(states, state.Name)
+	}
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+	return &StateMachineStatus{
+		Current:     machine.current,
+		Since:       machine.since,
+		States:      states,
+		Transitions: machine.transitions,
+	}
+}
+
+// enterInitialState executes the OnEntry action of the initial state, when the node starts.
+func (n *Node) enterInitialState() {
+	machine := n.getStateMachine()
+	if machine == nil {
+		return
+	}
+	machine.transitionMutex.Lock()
+	defer machine.transitionMutex.Unlock()
+	n.enterInitialStateLocked(machine)
+}
+
+// enterInitialStateLocked executes the OnEntry action of the initial state unless already done, e.g. when an event
+// is received before the node is done starting. It must be called with the transition mutex held.
+func (n *Node) enterInitialStateLocked(machine *stateMachine) {
+	machine.entered.Do(func() {
+		n.ExecuteAction(machine.states[machine.definition.Initial].OnEntry, nil)
+	})
+}
+
+// handleTransition takes the first possible transition for the event, if any.
+func (n *Node) handleTransition(ctx context.Context, event *Event) error {
+	machine := n.getStateMachine()
+
+	// Also held while the initial state is entered, which may happen outside of the dispatcher
+	machine.transitionMutex.Lock()
+	defer machine.transitionMutex.Unlock()
+	n.enterInitialStateLocked(machine)
+
+	machine.mutex.Lock()
+	from := machine.current
+	machine.mutex.Unlock()
+
+	var transition *Transition
+	for i := range machine.definition.Transitions {
+		t := &machine.definition.Transitions[i]
+		if t.Event == event.Name && t.leaves(from) && (t.Guard == nil || t.Guard(event)) {
+			transition = t
+			break
+		}
+	}
+	if transition == nil {
+		n.Logger.Debugf("no transition from %s on %s", from, event.Name)
+		return nil
+	}
+
+	if err := n.executeAction(ctx, machine.states[from].OnExit, event); err != nil {
+		return fmt.Errorf("transition from %s to %s aborted: %v", from, transition.To, err)
+	}
+	if err := n.executeAction(ctx, transition.Do, event); err != nil {
+		return fmt.Errorf("transition from %s to %s aborted: %v", from, transition.To, err)
+	}
+
+	machine.mutex.Lock()
+	machine.current = transition.To
+	machine.since = time.Now().UTC()
+	machine.transitions++
+	machine.mutex.Unlock()
+	n.Logger.Infof("state changed: %s -> %s (%s)", from, transition.To, event.Name)
+
+	payload, _ := json.Marshal(StateChange{From: from, To: transition.To, Event: event.Name})
+	if err := n.BroadcastEvent(StateChangedEvent, string(payload)); err != nil {
+		n.Logger.Errorf("could not broadcast state change: %v", err)
+	}
+
+	return n.executeAction(ctx, machine.states[transition.To].OnEntry, event)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateMachineRecorder records the OnEntry, OnExit and Do actions executed by a state machine.
+type stateMachineRecorder struct {
+	mutex    sync.Mutex
+	executed []string
+}
+
+func (r *stateMachineRecorder) action(name string) *Action {
+	return &Action{Name: name, Do: func(_ *Event) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.executed = append(r.executed, name)
+	}}
+}
+
+func (r *stateMachineRecorder) take() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	executed := r.executed
+	r.executed = nil
+	return executed
+}
+
+func newTestStateMachine(recorder *stateMachineRecorder) *StateMachine {
+	return &StateMachine{
+		Initial: "idle",
+		States: []State{
+			{Name: "idle", OnEntry: recorder.action("enter idle")},
+			{Name: "playing", OnEntry: recorder.action("enter playing"), OnExit: recorder.action("exit playing")},
+			{Name: "paused"},
+		},
+		Transitions: []Transition{
+			{From: []string{"idle", "paused"}, To: "playing", Event: "PLAY"},
+			{From: []string{"playing"}, To: "paused", Event: "PAUSE", Do: recorder.action("pause")},
+			{From: []string{"playing"}, To: "idle", Event: "FAIL", Do: &Action{
+				Name:      "fail",
+				DoContext: func(_ context.Context, _ *Event) error { return fmt.Errorf("failure") },
+			}},
+			{From: []string{AnyState}, To: "idle", Event: "STOP", Guard: func(event *Event) bool {
+				return event.Payload != "locked"
+			}},
+		},
+	}
+}
+
+func TestStateMachineTransitions(t *testing.T) {
+	n := newTestNode(t, "node", NewInMemoryEventBus())
+	recorder := &stateMachineRecorder{}
+	if err := n.SetStateMachine(newTestStateMachine(recorder)); err != nil {
+		t.Fatalf("could not set the state machine: %v", err)
+	}
+
+	// The events are handled in order by the same state machine
+	tests := []struct {
+		name     string
+		event    Event
+		state    string
+		executed []string
+		wantErr  bool
+	}{
+		{"no transition", Event{Name: "PAUSE"}, "idle", []string{"enter idle"}, false},
+		{"transition", Event{Name: "PLAY"}, "playing", []string{"enter playing"}, false},
+		{"failing transition", Event{Name: "FAIL"}, "playing", []string{"exit playing"}, true},
+		{"transition with an action", Event{Name: "PAUSE"}, "paused", []string{"exit playing", "pause"}, false},
+		{"guard", Event{Name: "STOP", Payload: "locked"}, "paused", nil, false},
+		{"from any state", Event{Name: "STOP"}, "idle", []string{"enter idle"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := n.handleTransition(context.Background(), &tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if state := n.CurrentState(); state != tt.state {
+				t.Errorf("state = %s, want %s", state, tt.state)
+			}
+			if executed := recorder.take(); !reflect.DeepEqual(executed, tt.executed) {
+				t.Errorf("executed %v, want %v", executed, tt.executed)
+			}
+		})
+	}
+
+	if status := n.getStateMachineStatus(); status.Transitions != 3 {
+		t.Errorf("%d transitions, want 3", status.Transitions)
+	}
+}
+
+func TestInvalidStateMachines(t *testing.T) {
+	states := []State{{Name: "a"}, {Name: "b"}}
+	tests := []struct {
+		name    string
+		machine *StateMachine
+	}{
+		{"nil", nil},
+		{"unknown initial state", &StateMachine{Initial: "c", States: states}},
+		{"state declared twice", &StateMachine{Initial: "a", States: []State{{Name: "a"}, {Name: "a"}}}},
+		{"any state", &StateMachine{Initial: "a", States: []State{{Name: "a"}, {Name: AnyState}}}},
+		{"transition without event", &StateMachine{Initial: "a", States: states, Transitions: []Transition{
+			{From: []string{"a"}, To: "b"},
+		}}},
+		{"transition without from", &StateMachine{Initial: "a", States: states, Transitions: []Transition{
+			{To: "b", Event: "GO"},
+		}}},
+		{"unknown from state", &StateMachine{Initial: "a", States: states, Transitions: []Transition{
+			{From: []string{"c"}, To: "b", Event: "GO"},
+		}}},
+		{"unknown to state", &StateMachine{Initial: "a", States: states, Transitions: []Transition{
+			{From: []string{"a"}, To: AnyState, Event: "GO"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNode(t, "node", NewInMemoryEventBus())
+			if err := n.SetStateMachine(tt.machine); err == nil {
+				t.Error("the state machine is accepted")
+			}
+			if n.CurrentState() != "" {
+				t.Error("the state machine is set")
+			}
+		})
+	}
+}
+
+func TestStateMachineInitialState(t *testing.T) {
+	tests := []struct {
+		name           string
+		setAfterStart  bool
+		eventsReceived bool
+	}{
+		{"set before start", false, false},
+		{"set after start", true, false},
+		{"events received first", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewInMemoryEventBus()
+			n := newTestNode(t, "node", bus)
+			other := newTestNode(t, "other", bus)
+			changes := make(chan *Event, 4)
+			other.OnEventDo(StateChangedEvent, &Action{Name: "record", Do: func(event *Event) { changes <- event }})
+			startTestNode(other)
+
+			recorder := &stateMachineRecorder{}
+			if !tt.setAfterStart {
+				if err := n.SetStateMachine(newTestStateMachine(recorder)); err != nil {
+					t.Fatalf("could not set the state machine: %v", err)
+				}
+			}
+			startTestNode(n)
+			if tt.eventsReceived {
+				// As if received before the node is done starting
+				if err := other.SendEventTo("node", "PLAY", ""); err != nil {
+					t.Fatalf("could not send the event: %v", err)
+				}
+				waitForEvent(t, changes)
+			}
+			if tt.setAfterStart {
+				if err := n.SetStateMachine(newTestStateMachine(recorder)); err != nil {
+					t.Fatalf("could not set the state machine: %v", err)
+				}
+			} else {
+				n.enterInitialState()
+			}
+
+			want := []string{"enter idle"}
+			if tt.eventsReceived {
+				want = append(want, "enter playing")
+			}
+			waitForExecutions(t, recorder, len(want))
+			if executed := recorder.take(); !reflect.DeepEqual(executed, want) {
+				t.Errorf("executed %v, want %v", executed, want)
+			}
+			if err := n.SetStateMachine(newTestStateMachine(recorder)); err == nil {
+				t.Error("a second state machine is accepted")
+			}
+		})
+	}
+}
+
+func waitForExecutions(t *testing.T, recorder *stateMachineRecorder, count int) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		recorder.mutex.Lock()
+		executed := len(recorder.executed)
+		recorder.mutex.Unlock()
+		if executed >= count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d actions executed, want %d", executed, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
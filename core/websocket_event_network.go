@@ -0,0 +1,230 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	webSocketReconnectDelay = 2 * time.Second
+	// webSocketDialTimeout bounds the connection to the hub, which may happen while sending an event
+	webSocketDialTimeout = 2 * time.Second
+)
+
+var webSocketDialer = &websocket.Dialer{
+	Proxy:            http.ProxyFromEnvironment,
+	HandshakeTimeout: webSocketDialTimeout,
+}
+
+// WebSocketEventNetwork is an EventNetwork connecting to a WebSocketHub.
+// The connection is established when the network is first used, once the node name is known,
+// and automatically re-established if lost. The hub is considered lost if it does not ping the network for
+// webSocketPongWait.
+// With the JSONCodec, events are sent as JSON in text messages, except events with a binary payload, sent as
+// binary envelopes (see encodeBinaryEnvelope) in binary messages. With other codecs, events are sent in binary
+// messages.
+type WebSocketEventNetwork struct {
+	hubURL                string
+	codec                 Codec
+	eventReceivedCallBack EventHandler
+	logger                *log.Entry
+
+	mutex     sync.Mutex
+	writeLock sync.Mutex
+	conn      *websocket.Conn
+	nodeName  string
+	listening bool
+}
+
+// NewWebSocketEventNetwork returns a network for the hub at hubURL, e.g. ws://localhost:7070/events
+func NewWebSocketEventNetwork(hubURL string) *WebSocketEventNetwork {
+	return NewWebSocketEventNetworkWithCodec(hubURL, JSONCodec)
+}
+
+// NewWebSocketEventNetworkWithCodec is similar to NewWebSocketEventNetwork, the events being sent with the given codec.
+func NewWebSocketEventNetworkWithCodec(hubURL string, codec Codec) *WebSocketEventNetwork {
+	logger := log.WithField("node", "na-event-network-setup")
+
+	if _, err := url.Parse(hubURL); err != nil {
+		logger.Fatalf("invalid hub url %s: %v", hubURL, err)
+	}
+
+	return &WebSocketEventNetwork{
+		hubURL: hubURL,
+		codec:  codec,
+		logger: logger.WithField("component", "event-network"),
+	}
+}
+
+func (w *WebSocketEventNetwork) BroadcastEvent(event *Event) {
+	if event.Receiver == "" {
+		event.Receiver = "*"
+	}
+
+	messageType := websocket.BinaryMessage
+	var data []byte
+	var err error
+	switch {
+	case w.codec != JSONCodec:
+		data, err = w.codec.Encode(event)
+	case event.IsBinary():
+		data, err = encodeBinaryEnvelope(event)
+	default:
+		messageType = websocket.TextMessage
+		data, err = json.Marshal(event)
+	}
+	if err != nil {
+		w.logger.Errorf("could not marshal event: %v", err)
+		return
+	}
+
+	conn, err := w.connection()
+	if err != nil {
+		w.logger.Errorf("could not send event: %v", err)
+		return
+	}
+
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+	if err := conn.WriteMessage(messageType, data); err != nil {
+		w.logger.Errorf("could not send event: %v", err)
+	}
+}
+
+func (w *WebSocketEventNetwork) SendEventTo(receiver string, event *Event) {
+	event.Receiver = receiver
+	w.BroadcastEvent(event)
+}
+
+func (w *WebSocketEventNetwork) SetReceivedEventCallback(handler EventHandler) {
+	w.eventReceivedCallBack = handler
+}
+
+func (w *WebSocketEventNetwork) SetNodeName(name string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.nodeName = name
+}
+
+func (w *WebSocketEventNetwork) StartListeningForEvents() {
+	w.mutex.Lock()
+	if w.listening {
+		w.mutex.Unlock()
+		return
+	}
+	w.listening = true
+	w.mutex.Unlock()
+
+	if _, err := w.connection(); err != nil {
+		w.logger.Fatalf("could not connect to hub: %v", err)
+	}
+
+	go w.readLoop()
+	w.logger.Info("Listening for events...")
+}
+
+func (w *WebSocketEventNetwork) SetLogger(logger *log.Entry) {
+	w.logger = logger
+}
+
+// connection returns the current connection to the hub, dialing it if needed.
+func (w *WebSocketEventNetwork) connection() (*websocket.Conn, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.conn != nil {
+		return w.conn, nil
+	}
+
+	u, err := url.Parse(w.hubURL)
+	if err != nil {
+		return nil, err
+	}
+	if w.nodeName != "" {
+		q := u.Query()
+		q.Set("node", w.nodeName)
+		u.RawQuery = q.Encode()
+	}
+
+	conn, _, err := webSocketDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial %s: %v", w.hubURL, err)
+	}
+	conn.SetReadLimit(webSocketMaxMessageSize)
+	// The hub pings its clients every webSocketPingPeriod
+	_ = conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	conn.SetPingHandler(func(data string) error {
+		if err := conn.SetReadDeadline(time.Now().Add(webSocketPongWait)); err != nil {
+			return err
+		}
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(webSocketWriteWait))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	w.conn = conn
+	w.logger.Debugf("connected to hub %s", w.hubURL)
+	return conn, nil
+}
+
+func (w *WebSocketEventNetwork) dropConnection(conn *websocket.Conn) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == conn {
+		w.conn = nil
+	}
+	conn.Close()
+}
+
+func (w *WebSocketEventNetwork) readLoop() {
+	for {
+		conn, err := w.connection()
+		if err != nil {
+			w.logger.Warnf("could not reconnect to hub, retrying in %s: %v", webSocketReconnectDelay, err)
+			time.Sleep(webSocketReconnectDelay)
+			continue
+		}
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				w.logger.Warnf("connection to hub lost: %v", err)
+				w.dropConnection(conn)
+				break
+			}
+
+			event, err := decodeWebSocketMessage(messageType, message)
+			if err != nil {
+				w.logger.Warnf("could not unmarshal event: %v", err)
+				continue
+			}
+
+			if w.eventReceivedCallBack != nil {
+				w.eventReceivedCallBack(event)
+			}
+		}
+	}
+}
+
+func decodeWebSocketMessage(messageType int, message []byte) (*Event, error) {
+	if messageType == websocket.BinaryMessage {
+		if codec, err := detectCodec(message); err == nil {
+			return codec.Decode(message)
+		}
+		return decodeBinaryEnvelope(message)
+	}
+
+	var event Event
+	if err := json.Unmarshal(message, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWebSocketEventNetwork returns a network connected to the hub, delivering its events to the returned
+// channel.
+func newTestWebSocketEventNetwork(t *testing.T, hubURL, name string) (*WebSocketEventNetwork, <-chan *Event) {
+	t.Helper()
+	network := NewWebSocketEventNetwork(hubURL)
+	network.SetLogger(newTestLogger())
+	network.SetNodeName(name)
+	events := receiveEvents(network)
+	network.StartListeningForEvents()
+	return network, events
+}
+
+func TestWebSocketHub(t *testing.T) {
+	hub := NewWebSocketHub(newTestLogger())
+	server := httptest.NewServer(hub)
+	defer server.Close()
+	hubURL := "ws" + strings.TrimPrefix(server.URL, "http") + WebSocketHubPath
+
+	a, aEvents := newTestWebSocketEventNetwork(t, hubURL, "a")
+	_, bEvents := newTestWebSocketEventNetwork(t, hubURL, "b")
+	_, cEvents := newTestWebSocketEventNetwork(t, hubURL, "c")
+	deadline := time.Now().Add(testTimeout)
+	for len(hub.ConnectedNodes()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("connected nodes: %v, want a, b and c", hub.ConnectedNodes())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name     string
+		receiver string
+		event    Event
+		// Whether a, b and c receive the event
+		received [3]bool
+	}{
+		{"broadcast", "", Event{Name: "PING", Emitter: "a", Payload: `{"n":1}`}, [3]bool{true, true, true}},
+		{"unicast", "b", Event{Name: "PING", Emitter: "a"}, [3]bool{false, true, false}},
+		{"binary unicast", "c", Event{Name: "IMAGE", Emitter: "a", Data: []byte{0, 1}}, [3]bool{false, false, true}},
+		{"unknown receiver", "d", Event{Name: "PING", Emitter: "a"}, [3]bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := tt.event
+			if tt.receiver == "" {
+				a.BroadcastEvent(&event)
+			} else {
+				a.SendEventTo(tt.receiver, &event)
+			}
+
+			for i, events := range []<-chan *Event{aEvents, bEvents, cEvents} {
+				if !tt.received[i] {
+					expectNoEvent(t, events)
+					continue
+				}
+				received := waitForEvent(t, events)
+				if received.Name != event.Name || received.Receiver != event.Receiver ||
+					received.Payload != event.Payload || string(received.Data) != string(event.Data) {
+					t.Errorf("received %+v, want %+v", received, event)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// WebSocketHubPath is the path on which the WebSocketHub accepts connections.
+	// Nodes identify themselves with the "node" query parameter (e.g. ws://hub:7070/events?node=my-node).
+	// Connections without a node name (e.g. browser based UIs) receive all the events, including unicast ones.
+	WebSocketHubPath        = "/events"
+	DefaultWebSocketHubAddr = ":7070"
+
+	webSocketWriteWait      = 10 * time.Second
+	webSocketPongWait       = 60 * time.Second
+	webSocketPingPeriod     = (webSocketPongWait * 9) / 10
+	webSocketMaxMessageSize = 1 << 20
+	webSocketSendBufferSize = 256
+)
+
+// WebSocketHub is a minimal event broker, fanning out the events received from a WebSocket
+// connection to the other connections. It only depends on the JSON Event format, so that browsers
+// can join the event network without any additional library. Events with a binary payload are
+// exchanged in binary messages, see WebSocketEventNetwork.
+type WebSocketHub struct {
+	logger   *log.Entry
+	upgrader websocket.Upgrader
+
+	mutex   sync.RWMutex
+	clients map[*webSocketHubClient]bool
+}
+
+type webSocketHubClient struct {
+	hub  *WebSocketHub
+	conn *websocket.Conn
+	name string
+	send chan webSocketMessage
+}
+
+type webSocketMessage struct {
+	messageType int
+	data        []byte
+}
+
+func NewWebSocketHub(logger *log.Entry) *WebSocketHub {
+	return &WebSocketHub{
+		logger: logger.WithField("component", "websocket-hub"),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+			// The hub is meant to be used by UIs served from anywhere on the demo network
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		clients: make(map[*webSocketHubClient]bool),
+	}
+}
+
+// Run starts serving the hub on addr, and blocks until the HTTP server stops.
+func (h *WebSocketHub) Run(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(WebSocketHubPath, h)
+	h.logger.Infof("Hub listening on %s%s", addr, WebSocketHubPath)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (h *WebSocketHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Errorf("could not upgrade connection: %v", err)
+		return
+	}
+
+	client := &webSocketHubClient{
+		hub:  h,
+		conn: conn,
+		name: r.URL.Query().Get("node"),
+		send: make(chan webSocketMessage, webSocketSendBufferSize),
+	}
+
+	h.mutex.Lock()
+	h.clients[client] = true
+	h.mutex.Unlock()
+	h.logger.Infof("client connected: %s (%s)", client.displayName(), r.RemoteAddr)
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// ConnectedNodes returns the names of the nodes currently connected to the hub.
+func (h *WebSocketHub) ConnectedNodes() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	names := make([]string, 0, len(h.clients))
+	for c := range h.clients {
+		if c.name != "" {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func (h *WebSocketHub) dispatch(from *webSocketHubClient, message webSocketMessage) {
+	event, err := decodeWebSocketMessage(message.messageType, message.data)
+	if err != nil {
+		h.logger.Warnf("ignoring invalid event from %s: %v", from.displayName(), err)
+		return
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for c := range h.clients {
+		if event.Receiver != "" && event.Receiver != "*" && c.name != "" && c.name != event.Receiver {
+			continue
+		}
+		select {
+		case c.send <- message:
+		default:
+			h.logger.Warnf("client %s is too slow, dropping event %s", c.displayName(), event.Name)
+		}
+	}
+}
+
+func (h *WebSocketHub) remove(client *webSocketHubClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+		h.logger.Infof("client disconnected: %s", client.displayName())
+	}
+}
+
+func (c *webSocketHubClient) displayName() string {
+	if c.name == "" {
+		return "anonymous"
+	}
+	return c.name
+}
+
+func (c *webSocketHubClient) readPump() {
+	defer func() {
+		c.hub.remove(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(webSocketMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	})
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.hub.logger.Warnf("connection with %s closed: %v", c.displayName(), err)
+			}
+			return
+		}
+		c.hub.dispatch(c, webSocketMessage{messageType: messageType, data: data})
+	}
+}
+
+func (c *webSocketHubClient) writePump() {
+	ticker := time.NewTicker(webSocketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+			if !ok {
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(message.messageType, message.data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
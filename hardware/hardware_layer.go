@@ -17,3 +17,17 @@ type Hal interface {
 	SetEventHandler(handler func(interface{}))
 	IsAvailable() bool
 }
+
+// Color is a RGB color.
+type Color struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// LedMatrix is implemented by the hardware layers providing a LED matrix, such as the Sense HAT.
+// ShowText scrolls a text across the matrix.
+type LedMatrix interface {
+	ShowText(text string, color Color) error
+	ClearLeds() error
+}
@@ -3,6 +3,7 @@
 package raspberrypi
 
 import (
+	"github.com/SINTEF-Infosec/demokit/hardware"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -47,3 +48,13 @@ func (r *SenseHatRaspberry) SetEventHandler(handler func(interface{})) {
 func (r *SenseHatRaspberry) IsAvailable() bool {
 	return true
 }
+
+// ShowText implements hardware.LedMatrix, scrolling the text on a blank background.
+func (r *SenseHatRaspberry) ShowText(text string, color hardware.Color) error {
+	return r.ShowMessage(text, 0.1, PixelColor{R: color.R, G: color.G, B: color.B}, Blank())
+}
+
+// ClearLeds implements hardware.LedMatrix.
+func (r *SenseHatRaspberry) ClearLeds() error {
+	return r.Clear(Blank())
+}